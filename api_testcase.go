@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/programmfabrik/apitest/pkg/lib/cookiejar"
 	"github.com/programmfabrik/apitest/pkg/lib/datastore"
 
 	"github.com/programmfabrik/apitest/pkg/lib/cjson"
@@ -38,6 +39,18 @@ type Case struct {
 	Delay           *int          `json:"delay_ms"`
 	BreakResponse   []interface{} `json:"break_response"`
 	CollectResponse interface{}   `json:"collect_response"`
+	Retry           *CaseRetry    `json:"retry"`
+	Load            *CaseLoad     `json:"load"`
+
+	// Instead of a request, a websocket connection can be tested
+	WebSocketData *interface{} `json:"websocket"`
+
+	// Tags are used with --tags and --skip-tags, in addition to the tags of the suite
+	Tags []string `json:"tags"`
+
+	// Template expressions (without {{ }}) to decide at runtime if the test is skipped
+	SkipIf string `json:"skip_if"`
+	RunIf  string `json:"run_if"`
 
 	LogNetwork *bool `json:"log_network"`
 	LogVerbose *bool `json:"log_verbose"`
@@ -48,6 +61,10 @@ type Case struct {
 	suiteIndex  int
 	index       int
 	dataStore   *datastore.Datastore
+	skipReason  string
+
+	cookieJars *cookiejar.Jars
+	cookieJar  string // used if the request has no cookie_jar
 
 	standardHeader          map[string]*string
 	standardHeaderFromStore map[string]string
@@ -58,6 +75,30 @@ type Case struct {
 	Filename string
 }
 
+// CaseRetry defines how often a failed test is run again from scratch
+type CaseRetry struct {
+	Count     int `json:"count"`
+	BackoffMs int `json:"backoff_ms"`
+	// Only retry if the last response had one of these status codes. Empty means any failure
+	OnStatus []int `json:"on_status"`
+}
+
+// retries tells if the test gets another attempt after the given failed one
+func (retry *CaseRetry) retries(attempt int, response api.Response) bool {
+	if retry == nil || attempt > retry.Count {
+		return false
+	}
+	if len(retry.OnStatus) == 0 {
+		return true
+	}
+	for _, status := range retry.OnStatus {
+		if status == response.StatusCode() {
+			return true
+		}
+	}
+	return false
+}
+
 func (testCase Case) runAPITestCase(parentReportElem *report.ReportElement) bool {
 	if testCase.Name == "" {
 		testCase.Name = "<no name>"
@@ -71,6 +112,24 @@ func (testCase Case) runAPITestCase(parentReportElem *report.ReportElement) bool
 	testCase.ReportElem = parentReportElem.NewChild(testCase.Name)
 	r := testCase.ReportElem
 
+	skipReason := testCase.skipReason
+	if skipReason == "" {
+		var err error
+		skipReason, err = conditionSkipReason(testCase.loader, testCase.manifestDir, testCase.SkipIf, testCase.RunIf)
+		if err != nil {
+			r.SaveToReportLog(fmt.Sprintf("Error during execution: %s", err))
+			logrus.Errorf("     [%2d] %s", testCase.index, err)
+			r.Leave(false)
+			return false
+		}
+	}
+	if skipReason != "" {
+		logrus.Infof("     [%2d] skipped: %s", testCase.index, skipReason)
+		r.Skip(skipReason)
+		r.Leave(true)
+		return true
+	}
+
 	start := time.Now()
 
 	// Store standard data into datastore
@@ -90,23 +149,54 @@ func (testCase Case) runAPITestCase(parentReportElem *report.ReportElement) bool
 		return false
 	}
 
-	success := true
-	if testCase.RequestData != nil {
-		success, err = testCase.run()
+	// A retried attempt replaces the responses of the failed one, so that the
+	// datastore indices of later tests stay the same
+	var responseCount int
+	if testCase.dataStore != nil {
+		responseCount = testCase.dataStore.ResponseCount()
 	}
 
-	elapsed := time.Since(start)
-	if err != nil {
-		r.SaveToReportLog(fmt.Sprintf("Error during execution: %s", err))
-		logrus.Errorf("     [%2d] %s", testCase.index, err)
-		success = false
-	}
+	var success bool
+	for attempt := 1; ; attempt++ {
+		var apiResponse api.Response
 
-	// Reverse if needed
-	if testCase.ReverseTestResult {
-		success = !success
+		success = true
+		if testCase.RequestData != nil && testCase.Load != nil {
+			success, err = testCase.runLoad()
+		} else if testCase.RequestData != nil {
+			success, apiResponse, err = testCase.run()
+		} else if testCase.WebSocketData != nil {
+			success, err = testCase.runWebSocket()
+		}
+
+		if err != nil {
+			r.SaveToReportLog(fmt.Sprintf("Error during execution: %s", err))
+			logrus.Errorf("     [%2d] %s", testCase.index, err)
+			success = false
+		}
+
+		// Reverse if needed
+		if testCase.ReverseTestResult {
+			success = !success
+		}
+
+		// Load blocks are not retried, max_error_rate decides about their success
+		if success || testCase.RequestData == nil || testCase.Load != nil || !testCase.Retry.retries(attempt, apiResponse) {
+			if attempt > 1 {
+				r.SetAttempts(attempt)
+			}
+			break
+		}
+
+		// Run the test again from scratch, the request is rendered anew
+		logrus.Warnf("     [%2d] attempt %d of %d failed, retrying in %dms", testCase.index, attempt, testCase.Retry.Count+1, testCase.Retry.BackoffMs)
+		r.SaveToReportLogF("Attempt %d of %d failed (status code %d)", attempt, testCase.Retry.Count+1, apiResponse.StatusCode())
+		time.Sleep(time.Duration(testCase.Retry.BackoffMs) * time.Millisecond)
+		testCase.dataStore.TruncateResponses(responseCount)
 	}
 
+	elapsed := time.Since(start)
+
 	fileBasename := filepath.Base(testCase.Filename)
 	if !success {
 		logrus.WithFields(logrus.Fields{"elapsed": elapsed.Seconds(), "file": fileBasename}).Warnf("     [%2d] failure", testCase.index)
@@ -240,17 +330,19 @@ func (testCase Case) executeRequest(counter int) (compare.CompareResult, api.Req
 		logrus.Tracef("[REQUEST]:\n%s\n\n", limitLines(req.ToString(logCurl), Config.Apitest.Limit.Request))
 	}
 
-	apiResp, err = req.Send()
+	// The format is needed to read the response, if it is a stream
+	expectedResponse, err := testCase.loadResponse()
 	if err != nil {
 		testCase.LogReq(req)
-		err = fmt.Errorf("error sending request: %s", err)
+		err = fmt.Errorf("error loading response: %s", err)
 		return responsesMatch, req, apiResp, err
 	}
+	req.ResponseFormat = expectedResponse.Format
 
-	expectedResponse, err := testCase.loadResponse()
+	apiResp, err = req.Send()
 	if err != nil {
 		testCase.LogReq(req)
-		err = fmt.Errorf("error loading response: %s", err)
+		err = fmt.Errorf("error sending request: %s", err)
 		return responsesMatch, req, apiResp, err
 	}
 	apiResp.Format = expectedResponse.Format
@@ -291,9 +383,58 @@ func (testCase Case) executeRequest(counter int) (compare.CompareResult, api.Req
 		return responsesMatch, req, apiResp, err
 	}
 
+	// The response time is not part of the response json, so it is checked on its own
+	if failure := timingFailure(expectedResponse.Timing(), apiResp.Duration(), "request"); failure != nil {
+		responsesMatch.Equal = false
+		responsesMatch.Failures = append(responsesMatch.Failures, *failure)
+	}
+	if failure := graphQLErrorsFailure(req, expectedResponse, apiResp); failure != nil {
+		responsesMatch.Equal = false
+		responsesMatch.Failures = append(responsesMatch.Failures, *failure)
+	}
+
 	return responsesMatch, req, apiResp, nil
 }
 
+// timingFailure checks that what took the given duration stayed within the limit
+func timingFailure(timing *api.Timing, took time.Duration, what string) *compare.CompareFailure {
+	if timing == nil || timing.MaxMs <= 0 || took <= time.Duration(timing.MaxMs)*time.Millisecond {
+		return nil
+	}
+	return &compare.CompareFailure{
+		Key:     "timing.max_ms",
+		Message: fmt.Sprintf("%s took %dms, expected at most %dms", what, took.Milliseconds(), timing.MaxMs),
+	}
+}
+
+// graphQLErrorsFailure fails a graphql request if the response has errors, unless
+// errors are declared in the body of the expected response
+func graphQLErrorsFailure(req api.Request, expected, got api.Response) *compare.CompareFailure {
+	if req.BodyType != "graphql" {
+		return nil
+	}
+	var gotBody struct {
+		Errors []interface{} `json:"errors"`
+	}
+	if json.Unmarshal(got.Body(), &gotBody) != nil || len(gotBody.Errors) == 0 {
+		return nil
+	}
+	var expectedBody map[string]interface{}
+	if json.Unmarshal(expected.Body(), &expectedBody) == nil {
+		if _, ok := expectedBody["errors"]; ok {
+			return nil
+		}
+		if _, ok := expectedBody["errors:control"]; ok {
+			return nil
+		}
+	}
+	errorsJSON, _ := json.Marshal(gotBody.Errors)
+	return &compare.CompareFailure{
+		Key:     "body.errors",
+		Message: fmt.Sprintf("graphql response has errors: %s", errorsJSON),
+	}
+}
+
 // LogResp print the response to the console
 func (testCase Case) LogResp(response api.Response) {
 	errString := fmt.Sprintf("[RESPONSE]:\n%s\n\n", limitLines(response.ToString(), Config.Apitest.Limit.Response))
@@ -331,7 +472,7 @@ func limitLines(in string, limitCount int) string {
 	return out
 }
 
-func (testCase Case) run() (bool, error) {
+func (testCase Case) run() (bool, api.Response, error) {
 	var (
 		responsesMatch compare.CompareResult
 		request        api.Request
@@ -363,7 +504,7 @@ func (testCase Case) run() (bool, error) {
 		}
 		if err != nil {
 			testCase.LogResp(apiResponse)
-			return false, err
+			return false, apiResponse, err
 		}
 
 		if responsesMatch.Equal && !collectPresent {
@@ -374,20 +515,20 @@ func (testCase Case) run() (bool, error) {
 		if err != nil {
 			testCase.LogReq(request)
 			testCase.LogResp(apiResponse)
-			return false, fmt.Errorf("error checking for break response: %s", err)
+			return false, apiResponse, fmt.Errorf("error checking for break response: %s", err)
 		}
 
 		if breakPresent {
 			testCase.LogReq(request)
 			testCase.LogResp(apiResponse)
-			return false, fmt.Errorf("Break response found")
+			return false, apiResponse, fmt.Errorf("Break response found")
 		}
 
 		collectLeft, err := testCase.checkCollectResponse(request, apiResponse)
 		if err != nil {
 			testCase.LogReq(request)
 			testCase.LogResp(apiResponse)
-			return false, fmt.Errorf("error checking for continue response: %s", err)
+			return false, apiResponse, fmt.Errorf("error checking for continue response: %s", err)
 		}
 
 		if collectPresent && collectLeft <= 0 {
@@ -423,7 +564,7 @@ func (testCase Case) run() (bool, error) {
 				if err != nil {
 					testCase.LogReq(request)
 					testCase.LogResp(apiResponse)
-					return false, err
+					return false, apiResponse, err
 				}
 				logrus.Errorf("Collect response not found: %s", jsonV)
 				r.SaveToReportLog(fmt.Sprintf("Collect response not found: %s", jsonV))
@@ -432,7 +573,7 @@ func (testCase Case) run() (bool, error) {
 
 		testCase.LogReq(request)
 		testCase.LogResp(apiResponse)
-		return false, nil
+		return false, apiResponse, nil
 	}
 
 	if testCase.WaitAfter != nil {
@@ -440,7 +581,7 @@ func (testCase Case) run() (bool, error) {
 		time.Sleep(time.Duration(*testCase.WaitAfter) * time.Millisecond)
 	}
 
-	return true, nil
+	return true, apiResponse, nil
 }
 
 func (testCase Case) loadRequest() (api.Request, error) {
@@ -504,6 +645,10 @@ func (testCase Case) loadRequestSerialization() (api.Request, error) {
 	err = cjson.Unmarshal(specBytes, &spec)
 	spec.ManifestDir = testCase.manifestDir
 	spec.DataStore = testCase.dataStore
+	spec.CookieJars = testCase.cookieJars
+	if spec.CookieJar == "" {
+		spec.CookieJar = testCase.cookieJar
+	}
 
 	if spec.ServerURL == "" {
 		spec.ServerURL = testCase.ServerURL
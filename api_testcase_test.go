@@ -6,6 +6,7 @@ import (
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,6 +15,7 @@ import (
 
 	"github.com/programmfabrik/apitest/pkg/lib/filesystem"
 	"github.com/programmfabrik/apitest/pkg/lib/report"
+	"github.com/programmfabrik/apitest/pkg/lib/template"
 	go_test_utils "github.com/programmfabrik/go-test-utils"
 	"github.com/spf13/afero"
 )
@@ -628,3 +630,227 @@ func TestCookiesReceivedFromRequest(t *testing.T) {
 		t.Fatalf("Did fail but it should not")
 	}
 }
+
+func TestSkipIfAndRunIf(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer ts.Close()
+
+	store := datastore.NewStore(false)
+	store.Set("feature", "off")
+
+	tests := []struct {
+		manifest string
+		skipped  bool
+	}{
+		{`{"request": {"endpoint": "a", "method": "GET"}, "skip_if": "eq (datastore \"feature\") \"off\""}`, true},
+		{`{"request": {"endpoint": "a", "method": "GET"}, "skip_if": "eq (datastore \"feature\") \"on\""}`, false},
+		{`{"request": {"endpoint": "a", "method": "GET"}, "run_if": "eq (datastore \"feature\") \"on\""}`, true},
+		{`{"request": {"endpoint": "a", "method": "GET"}, "run_if": "datastore \"feature\""}`, false},
+	}
+
+	for _, tc := range tests {
+		requests = 0
+		r := report.NewReport()
+
+		var test Case
+		err := json.Unmarshal([]byte(tc.manifest), &test)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.ServerURL = ts.URL
+		test.dataStore = store
+		test.loader = template.NewLoader(store)
+
+		if !test.runAPITestCase(r.Root()) {
+			t.Errorf("%s: did fail but it should not", tc.manifest)
+		}
+		if skipped := r.Root().SubTests[0].Status == report.StatusSkipped; skipped != tc.skipped {
+			t.Errorf("%s: expected skipped=%v", tc.manifest, tc.skipped)
+		}
+		if sent := requests > 0; sent == tc.skipped {
+			t.Errorf("%s: expected request sent=%v", tc.manifest, !tc.skipped)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var requests, failures int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		retry    string
+		failures int
+		requests int
+		status   string
+	}{
+		{``, 1, 1, report.StatusFailure},
+		{`"retry": {"count": 2, "backoff_ms": 1},`, 1, 2, report.StatusFlakyPassed},
+		{`"retry": {"count": 2},`, 0, 1, report.StatusSuccess},
+		{`"retry": {"count": 1},`, 3, 2, report.StatusFailure},
+		{`"retry": {"count": 2, "on_status": [503]},`, 2, 3, report.StatusFlakyPassed},
+		{`"retry": {"count": 2, "on_status": [502]},`, 2, 1, report.StatusFailure},
+	}
+
+	for _, tc := range tests {
+		requests = 0
+		failures = tc.failures
+		r := report.NewReport()
+
+		manifest := `{` + tc.retry + `"request": {"endpoint": "a", "method": "GET"}, "response": {"statuscode": 200}}`
+		var test Case
+		err := json.Unmarshal([]byte(manifest), &test)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.ServerURL = ts.URL
+		test.dataStore = datastore.NewStore(false)
+		test.dataStore.AppendResponse(`{"statuscode":201}`)
+		test.loader = template.NewLoader(test.dataStore)
+
+		success := test.runAPITestCase(r.Root())
+		if success != (tc.status != report.StatusFailure) {
+			t.Errorf("%s: unexpected result %v", manifest, success)
+		}
+		go_test_utils.AssertIntEquals(t, tc.requests, requests)
+		go_test_utils.AssertStringEquals(t, tc.status, r.Root().SubTests[0].Status)
+
+		// Only the response of the last attempt is stored after the earlier response
+		go_test_utils.AssertIntEquals(t, 2, test.dataStore.ResponseCount())
+		first, _ := test.dataStore.Get("0")
+		go_test_utils.AssertStringEquals(t, `{"statuscode":201}`, first.(string))
+	}
+}
+
+func TestResponseTiming(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		maxMs   int
+		success bool
+	}{
+		{0, true},
+		{5, false},
+		{5000, true},
+	}
+
+	for _, tc := range tests {
+		r := report.NewReport()
+		r.Root().NoLogTime = true
+
+		manifest := fmt.Sprintf(`{"request": {"endpoint": "a", "method": "GET"}, "response": {"timing": {"max_ms": %d}}}`, tc.maxMs)
+		var test Case
+		err := json.Unmarshal([]byte(manifest), &test)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.ServerURL = ts.URL
+		test.dataStore = datastore.NewStore(false)
+		test.loader = template.NewLoader(test.dataStore)
+
+		if test.runAPITestCase(r.Root()) != tc.success {
+			t.Errorf("max_ms %d: expected success=%v", tc.maxMs, tc.success)
+		}
+		if !tc.success {
+			log := strings.Join(r.GetLog(), "\n")
+			if !strings.Contains(log, "[timing.max_ms] request took") {
+				t.Errorf("max_ms %d: expected timing failure in log, got: %s", tc.maxMs, log)
+			}
+		}
+	}
+}
+
+func TestRedirectAssertions(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.Redirect(w, r, "/session", http.StatusFound)
+		case "/session":
+			http.Redirect(w, r, "/home", http.StatusMovedPermanently)
+		}
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		manifest string
+		success  bool
+	}{
+		{`{"request": {"endpoint": "login", "method": "GET", "follow_redirects": false}, "response": {"statuscode": 302, "header": {"Location": ["/session"]}}}`, true},
+		{`{"request": {"endpoint": "login", "method": "GET"}, "response": {"redirects": [{"statuscode": 302, "location": "/session"}, {"statuscode": 301, "location": "/home"}], "redirects:control": {"order_matters": true}}}`, true},
+		{`{"request": {"endpoint": "login", "method": "GET"}, "response": {"redirects": [{"statuscode": 301, "location": "/home"}, {"statuscode": 302, "location": "/session"}], "redirects:control": {"order_matters": true}}}`, false},
+		{`{"request": {"endpoint": "login", "method": "GET", "max_redirects": 1}}`, false},
+	}
+
+	for i, tc := range tests {
+		r := report.NewReport()
+		r.Root().NoLogTime = true
+
+		var test Case
+		err := json.Unmarshal([]byte(tc.manifest), &test)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.ServerURL = ts.URL
+		test.dataStore = datastore.NewStore(false)
+		test.loader = template.NewLoader(test.dataStore)
+
+		if test.runAPITestCase(r.Root()) != tc.success {
+			t.Errorf("%d: expected success=%v, log: %s", i, tc.success, strings.Join(r.GetLog(), "\n"))
+		}
+	}
+}
+
+func TestGraphQLErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var gql struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&gql)
+		if gql.Variables["id"] == nil {
+			w.Write([]byte(`{"data": {"user": null}, "errors": [{"message": "id missing"}]}`))
+			return
+		}
+		w.Write([]byte(`{"data": {"user": {"id": 1}}}`))
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		manifest string
+		success  bool
+	}{
+		{`{"request": {"endpoint": "graphql", "method": "POST", "body_type": "graphql", "body": {"query": "{ user(id: $id) { id } }", "variables": {"id": 1}}}, "response": {"body": {"data": {"user": {"id": 1}}}}}`, true},
+		{`{"request": {"endpoint": "graphql", "method": "POST", "body_type": "graphql", "body": {"query": "{ user(id: $id) { id } }"}}, "response": {"body": {"data": {"user": null}}}}`, false},
+		{`{"request": {"endpoint": "graphql", "method": "POST", "body_type": "graphql", "body": {"query": "{ user(id: $id) { id } }"}}}`, false},
+		{`{"request": {"endpoint": "graphql", "method": "POST", "body_type": "graphql", "body": {"query": "{ user(id: $id) { id } }"}}, "response": {"body": {"errors": [{"message": "id missing"}]}}}`, true},
+	}
+
+	for i, tc := range tests {
+		r := report.NewReport()
+		r.Root().NoLogTime = true
+
+		var test Case
+		err := json.Unmarshal([]byte(tc.manifest), &test)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.ServerURL = ts.URL
+		test.dataStore = datastore.NewStore(false)
+		test.loader = template.NewLoader(test.dataStore)
+
+		if test.runAPITestCase(r.Root()) != tc.success {
+			t.Errorf("%d: expected success=%v, log: %s", i, tc.success, strings.Join(r.GetLog(), "\n"))
+		}
+	}
+}
@@ -14,7 +14,9 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/programmfabrik/apitest/internal/httpproxy"
+	"github.com/programmfabrik/apitest/pkg/lib/api"
 	"github.com/programmfabrik/apitest/pkg/lib/cjson"
+	"github.com/programmfabrik/apitest/pkg/lib/cookiejar"
 	"github.com/programmfabrik/apitest/pkg/lib/datastore"
 	"github.com/programmfabrik/apitest/pkg/lib/filesystem"
 	"github.com/programmfabrik/apitest/pkg/lib/report"
@@ -30,16 +32,42 @@ type Suite struct {
 		Addr     string                `json:"addr"`
 		Dir      string                `json:"dir"`
 		Testmode bool                  `json:"testmode"`
+		H2C      bool                  `json:"h2c"`
 		Proxy    httpproxy.ProxyConfig `json:"proxy"`
 	} `json:"http_server,omitempty"`
 	Tests []interface{}          `json:"tests"`
 	Store map[string]interface{} `json:"store"`
 
+	// Hooks are lists of tests like Tests. after_all runs even if a test failed,
+	// after_each runs for every test that had its before_each run
+	BeforeAll  []interface{} `json:"before_all"`
+	AfterAll   []interface{} `json:"after_all"`
+	BeforeEach []interface{} `json:"before_each"`
+	AfterEach  []interface{} `json:"after_each"`
+
+	// Tags are inherited by all tests of the suite, used with --tags and --skip-tags
+	Tags []string `json:"tags"`
+
+	// Template expressions (without {{ }}) to decide at runtime if the suite is skipped
+	SkipIf string `json:"skip_if"`
+	RunIf  string `json:"run_if"`
+
+	// Exclusive suites never run in parallel with other suites (see --parallel-suites)
+	Exclusive bool `json:"exclusive"`
+
+	// Timing limits the time of the whole suite, including hooks
+	Timing *api.Timing `json:"timing"`
+
+	// CookieJar keeps the cookies of all requests in a jar and sends them with later
+	// requests. Requests can use other named jars with their cookie_jar key
+	CookieJar bool `json:"cookie_jar"`
+
 	StandardHeader          map[string]*string `yaml:"header" json:"header"`
 	StandardHeaderFromStore map[string]string  `yaml:"header_from_store" json:"header_from_store"`
 
 	Config          TestToolConfig
 	datastore       *datastore.Datastore
+	cookieJars      *cookiejar.Jars
 	manifestDir     string
 	manifestPath    string
 	reporterRoot    *report.ReportElement
@@ -54,12 +82,14 @@ type Suite struct {
 
 // NewTestSuite creates a new suite on which we execute our tests on. Normally this only gets call from within the apitest main command
 func NewTestSuite(config TestToolConfig, manifestPath string, r *report.ReportElement, datastore *datastore.Datastore, index int) (*Suite, error) {
+	cookieJars := cookiejar.NewJars()
 	suite := Suite{
 		Config:       config,
 		manifestDir:  filepath.Dir(manifestPath),
 		manifestPath: manifestPath,
 		reporterRoot: r,
 		datastore:    datastore,
+		cookieJars:   cookieJars,
 		index:        index,
 	}
 	// Here we create this additional struct in order to preload the suite manifest
@@ -71,6 +101,7 @@ func NewTestSuite(config TestToolConfig, manifestPath string, r *report.ReportEl
 		manifestPath: manifestPath,
 		reporterRoot: r,
 		datastore:    datastore,
+		cookieJars:   cookieJars,
 		index:        index,
 	}
 
@@ -161,22 +192,78 @@ func (ats *Suite) Run() bool {
 	r := ats.reporterRoot
 	logrus.Infof("[%2d] '%s'", ats.index, ats.Name)
 
+	if reason := ats.Config.Filter.suiteSkipReason(ats.Name, ats.Tags, ats.Tests); reason != "" {
+		logrus.Infof("[%2d] skipped: %s", ats.index, reason)
+		r.Skip(reason)
+		return true
+	}
+
+	loader, err := ats.newLoader()
+	if err == nil {
+		var reason string
+		reason, err = conditionSkipReason(loader, ats.manifestDir, ats.SkipIf, ats.RunIf)
+		if reason != "" {
+			logrus.Infof("[%2d] skipped: %s", ats.index, reason)
+			r.Skip(reason)
+			return true
+		}
+	}
+	if err != nil {
+		logrus.Errorf("[%2d] %s", ats.index, err)
+		r.SaveToReportLog(err.Error())
+		return false
+	}
+
 	ats.StartHttpServer()
 
 	start := time.Now()
 
-	success := true
+	success := ats.runHooks("before_all", ats.BeforeAll)
+	skipReason := "before_all failed"
 	for k, v := range ats.Tests {
+		// Tests after a failure are not run, but still reported
+		if !success {
+			skipTest(r, v, k, skipReason)
+			continue
+		}
+
+		// Filtered and skipped tests are not run with before_each and after_each
+		if reason := ats.testSkipReason(v); reason != "" {
+			skipTest(r, v, k, reason)
+			continue
+		}
+
+		if !ats.runHooks("before_each", ats.BeforeEach) {
+			success = false
+			skipReason = "before_each failed"
+			skipTest(r, v, k, skipReason)
+			continue
+		}
+
 		child := r.NewChild(strconv.Itoa(k))
-		sTestSuccess := ats.parseAndRunTest(v, ats.manifestDir, ats.manifestPath, k, false, child)
+		sTestSuccess := ats.parseAndRunTest(v, ats.manifestDir, ats.manifestPath, k, false, true, child)
 		child.Leave(sTestSuccess)
+
+		if !ats.runHooks("after_each", ats.AfterEach) {
+			sTestSuccess = false
+		}
 		if !sTestSuccess {
 			success = false
-			break
+			skipReason = "an earlier test failed"
 		}
 	}
 
+	// after_all must clean up, even if anything before failed
+	if !ats.runHooks("after_all", ats.AfterAll) {
+		success = false
+	}
+
 	elapsed := time.Since(start)
+	if failure := timingFailure(ats.Timing, elapsed, "suite"); failure != nil {
+		logrus.Errorf("[%2d] %s", ats.index, failure)
+		r.SaveToReportLog(failure.String())
+		success = false
+	}
 	r.Leave(success)
 	if success {
 		logrus.WithFields(logrus.Fields{"elapsed": elapsed.Seconds()}).Infof("[%2d] success", ats.index)
@@ -189,23 +276,100 @@ func (ats *Suite) Run() bool {
 	return success
 }
 
+// runHooks runs the tests of a hook section, each hook run gets its own entry in the report
+func (ats *Suite) runHooks(name string, hooks []interface{}) bool {
+	if len(hooks) == 0 {
+		return true
+	}
+
+	logrus.Infof("[%2d] %s", ats.index, name)
+
+	r := ats.reporterRoot.NewChild(name)
+	success := true
+	for k, v := range hooks {
+		child := r.NewChild(strconv.Itoa(k))
+		// Hooks are never filtered out by --tags, --skip-tags or --run
+		sTestSuccess := ats.parseAndRunTest(v, ats.manifestDir, ats.manifestPath, k, false, false, child)
+		child.Leave(sTestSuccess)
+		if !sTestSuccess {
+			success = false
+			break
+		}
+	}
+	r.Leave(success)
+
+	return success
+}
+
+// testSkipReason tells why a test of the suite is filtered out or skipped by its
+// skip_if or run_if, before it is loaded. Tests in external files are filtered
+// when they are run
+func (ats *Suite) testSkipReason(v interface{}) string {
+	test, ok := v.(util.JsonObject)
+	if !ok {
+		return ""
+	}
+	name, tags := nameAndTags(test)
+	if reason := ats.Config.Filter.caseSkipReason(ats.Name, name, ats.Tags, tags); reason != "" {
+		return reason
+	}
+
+	skipIf, _ := test["skip_if"].(string)
+	runIf, _ := test["run_if"].(string)
+	if skipIf == "" && runIf == "" {
+		return ""
+	}
+	loader, err := ats.newLoader()
+	if err != nil {
+		return ""
+	}
+	// An invalid expression is reported when the test is run
+	reason, _ := conditionSkipReason(loader, ats.manifestDir, skipIf, runIf)
+	return reason
+}
+
+// skipTest adds a skipped entry for a test that is not run to the report
+func skipTest(r *report.ReportElement, v interface{}, k int, reason string) {
+	name := testName(v)
+	if name == "" {
+		name = strconv.Itoa(k)
+	}
+	child := r.NewChild(name)
+	child.Skip(reason)
+	child.Leave(true)
+}
+
+// testName returns the name of a test that was not loaded yet, or its path for external tests
+func testName(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case util.JsonObject:
+		name, _ := t["name"].(string)
+		return name
+	case json.RawMessage:
+		var i interface{}
+		if err := json.Unmarshal(t, &i); err != nil {
+			return ""
+		}
+		return testName(i)
+	default:
+		return ""
+	}
+}
+
 type TestContainer struct {
 	CaseByte json.RawMessage
 	Path     string
 }
 
-func (ats *Suite) parseAndRunTest(v interface{}, manifestDir, testFilePath string, k int, runParallel bool, r *report.ReportElement) bool {
+func (ats *Suite) parseAndRunTest(v interface{}, manifestDir, testFilePath string, k int, runParallel, applyFilter bool, r *report.ReportElement) bool {
 	//Init variables
-	loader := template.NewLoader(ats.datastore)
-
-	loader.HTTPServerHost = ats.HTTPServerHost
-	serverURL, err := url.Parse(ats.Config.ServerURL)
+	loader, err := ats.newLoader()
 	if err != nil {
 		logrus.Error(fmt.Errorf("can not load server url into test (%s): %s", testFilePath, err))
 		return false
 	}
-	loader.ServerURL = serverURL
-	loader.OAuthClient = ats.Config.OAuthClient
 
 	isParallelPathSpec := false
 	switch t := v.(type) {
@@ -240,7 +404,7 @@ func (ats *Suite) parseAndRunTest(v interface{}, manifestDir, testFilePath strin
 		go func() {
 			for ki, v := range testCases {
 				waitCh <- true
-				go testGoRoutine(k, ki, v, ats, testFilePath, manifestDir, dir, r, loader, waitCh, succCh, isParallelPathSpec || runParallel)
+				go testGoRoutine(k, ki, v, ats, testFilePath, manifestDir, dir, r, loader, waitCh, succCh, isParallelPathSpec || runParallel, applyFilter)
 			}
 		}()
 
@@ -248,6 +412,12 @@ func (ats *Suite) parseAndRunTest(v interface{}, manifestDir, testFilePath strin
 			select {
 			case succ := <-succCh:
 				if succ == false {
+					// Run one by one, the tests after the failed one were never started
+					if d == 1 {
+						for ki, v := range testCases[i+1:] {
+							skipTest(r, v, i+1+ki, "an earlier test failed")
+						}
+					}
 					return false
 				}
 			}
@@ -266,7 +436,7 @@ func (ats *Suite) parseAndRunTest(v interface{}, manifestDir, testFilePath strin
 		// If objects are different, we did have a Go template, recurse one level deep
 		if string(requestBytes) != string(testObj) {
 			return ats.parseAndRunTest([]byte(requestBytes), filepath.Join(manifestDir, dir),
-				testFilePath, k, isParallelPathSpec, r)
+				testFilePath, k, isParallelPathSpec, applyFilter, r)
 		}
 
 		// Its a JSON at this point, assign and proceed to parse
@@ -287,9 +457,9 @@ func (ats *Suite) parseAndRunTest(v interface{}, manifestDir, testFilePath strin
 					return false
 				}
 
-				return ats.parseAndRunTest(sS, filepath.Join(manifestDir, dir), testFilePath, k, isParallelPathSpec, r)
+				return ats.parseAndRunTest(sS, filepath.Join(manifestDir, dir), testFilePath, k, isParallelPathSpec, applyFilter, r)
 			} else {
-				return ats.runSingleTest(TestContainer{CaseByte: testObj, Path: filepath.Join(manifestDir, dir)}, r, testFilePath, loader, k, runParallel)
+				return ats.runSingleTest(TestContainer{CaseByte: testObj, Path: filepath.Join(manifestDir, dir)}, r, testFilePath, loader, k, runParallel, applyFilter)
 			}
 		} else {
 			// Malformed json
@@ -302,7 +472,7 @@ func (ats *Suite) parseAndRunTest(v interface{}, manifestDir, testFilePath strin
 	return true
 }
 
-func (ats *Suite) runSingleTest(tc TestContainer, r *report.ReportElement, testFilePath string, loader template.Loader, k int, isParallel bool) bool {
+func (ats *Suite) runSingleTest(tc TestContainer, r *report.ReportElement, testFilePath string, loader template.Loader, k int, isParallel, applyFilter bool) bool {
 	r.SetName(testFilePath)
 
 	var test Case
@@ -321,8 +491,13 @@ func (ats *Suite) runSingleTest(tc TestContainer, r *report.ReportElement, testF
 	test.suiteIndex = ats.index
 	test.index = k
 	test.dataStore = ats.datastore
+	test.cookieJars = ats.cookieJars
+	test.cookieJar = ats.defaultCookieJar()
 	test.standardHeader = ats.StandardHeader
 	test.standardHeaderFromStore = ats.StandardHeaderFromStore
+	if applyFilter {
+		test.skipReason = ats.Config.Filter.caseSkipReason(ats.Name, test.Name, ats.Tags, test.Tags)
+	}
 	if isParallel {
 		test.ContinueOnFailure = true
 	}
@@ -336,6 +511,9 @@ func (ats *Suite) runSingleTest(tc TestContainer, r *report.ReportElement, testF
 	if test.ServerURL == "" {
 		test.ServerURL = ats.Config.ServerURL
 	}
+	if test.Retry == nil && ats.Config.Retries > 0 {
+		test.Retry = &CaseRetry{Count: ats.Config.Retries}
+	}
 	success := test.runAPITestCase(r)
 
 	if !success && !test.ContinueOnFailure {
@@ -345,17 +523,36 @@ func (ats *Suite) runSingleTest(tc TestContainer, r *report.ReportElement, testF
 	return true
 }
 
-func (ats *Suite) loadManifest() ([]byte, error) {
-	var res []byte
-	logrus.Tracef("Loading manifest: %s", ats.manifestPath)
+// defaultCookieJar returns the jar for requests without cookie_jar, if the suite uses one
+func (ats *Suite) defaultCookieJar() string {
+	if ats.CookieJar {
+		return "default"
+	}
+	return ""
+}
+
+// newLoader returns a template loader with the datastore and servers of the suite
+func (ats *Suite) newLoader() (template.Loader, error) {
 	loader := template.NewLoader(ats.datastore)
 	loader.HTTPServerHost = ats.HTTPServerHost
 	serverURL, err := url.Parse(ats.Config.ServerURL)
 	if err != nil {
-		return nil, fmt.Errorf("can not load server url into manifest (%s): %s", ats.manifestPath, err)
+		return loader, err
 	}
 	loader.ServerURL = serverURL
 	loader.OAuthClient = ats.Config.OAuthClient
+	loader.CookieJars = ats.cookieJars
+	loader.StubDatastore = ats.Config.DryRun
+	return loader, nil
+}
+
+func (ats *Suite) loadManifest() ([]byte, error) {
+	var res []byte
+	logrus.Tracef("Loading manifest: %s", ats.manifestPath)
+	loader, err := ats.newLoader()
+	if err != nil {
+		return nil, fmt.Errorf("can not load server url into manifest (%s): %s", ats.manifestPath, err)
+	}
 	manifestFile, err := filesystem.Fs.Open(ats.manifestPath)
 	if err != nil {
 		return res, fmt.Errorf("error opening manifestPath (%s): %s", ats.manifestPath, err)
@@ -369,7 +566,7 @@ func (ats *Suite) loadManifest() ([]byte, error) {
 	return loader.Render(manifestTmpl, ats.manifestDir, nil)
 }
 
-func testGoRoutine(k, ki int, v json.RawMessage, ats *Suite, testFilePath, manifestDir, dir string, r *report.ReportElement, loader template.Loader, waitCh, succCh chan bool, runParallel bool) {
+func testGoRoutine(k, ki int, v json.RawMessage, ats *Suite, testFilePath, manifestDir, dir string, r *report.ReportElement, loader template.Loader, waitCh, succCh chan bool, runParallel, applyFilter bool) {
 	success := false
 
 	//Check if is @ and if so load the test
@@ -383,10 +580,10 @@ func testGoRoutine(k, ki int, v json.RawMessage, ats *Suite, testFilePath, manif
 			success = false
 			break
 		}
-		success = ats.parseAndRunTest(sS, filepath.Join(manifestDir, dir), testFilePath, k+ki, runParallel, r)
+		success = ats.parseAndRunTest(sS, filepath.Join(manifestDir, dir), testFilePath, k+ki, runParallel, applyFilter, r)
 	default:
 		success = ats.runSingleTest(TestContainer{CaseByte: v, Path: filepath.Join(manifestDir, dir)},
-			r, testFilePath, loader, ki, runParallel)
+			r, testFilePath, loader, ki, runParallel, applyFilter)
 	}
 
 	succCh <- success
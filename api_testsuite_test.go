@@ -1,9 +1,16 @@
 package main
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/programmfabrik/apitest/pkg/lib/datastore"
 	"github.com/programmfabrik/apitest/pkg/lib/filesystem"
+	"github.com/programmfabrik/apitest/pkg/lib/report"
+	go_test_utils "github.com/programmfabrik/go-test-utils"
 	"github.com/spf13/afero"
 )
 
@@ -26,3 +33,213 @@ func TestLoadManifest(t *testing.T) {
 	}
 
 }
+
+func TestSuiteHooks(t *testing.T) {
+	calls := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(500)
+		}
+	}))
+	defer ts.Close()
+
+	filesystem.Fs = afero.NewMemMapFs()
+	afero.WriteFile(filesystem.Fs, "manifest.json", []byte(`{
+		"name": "hooks",
+		"before_all": [{"request": {"endpoint": "before_all", "method": "GET"}}],
+		"before_each": [{"request": {"endpoint": "before_each", "method": "GET"}}],
+		"after_each": [{"request": {"endpoint": "after_each", "method": "GET"}}],
+		"after_all": [{"request": {"endpoint": "after_all", "method": "GET"}}],
+		"tests": [
+			{"request": {"endpoint": "ok", "method": "GET"}},
+			{"request": {"endpoint": "fail", "method": "GET"}},
+			{"request": {"endpoint": "never", "method": "GET"}}
+		]
+	}`), 644)
+
+	r := report.NewReport()
+	suite, err := NewTestSuite(TestToolConfig{ServerURL: ts.URL}, "manifest.json", r.Root(), datastore.NewStore(false), 0)
+	go_test_utils.ExpectNoError(t, err, "error loading suite")
+
+	if suite.Run() {
+		t.Error("Expected suite to fail")
+	}
+
+	go_test_utils.AssertStringEquals(t,
+		"/before_all /before_each /ok /after_each /before_each /fail /after_each /after_all",
+		strings.Join(calls, " "))
+
+	names := []string{}
+	for _, c := range r.Root().SubTests {
+		names = append(names, c.Name)
+	}
+	go_test_utils.AssertStringEquals(t,
+		"before_all before_each manifest_json after_each before_each manifest_json after_each 2 after_all",
+		strings.Join(names, " "))
+
+	// The test after the failed one is not run, but reported as skipped
+	go_test_utils.AssertStringEquals(t, report.StatusSkipped, r.Root().SubTests[7].Status)
+	go_test_utils.AssertStringEquals(t, "an earlier test failed", r.Root().SubTests[7].SkipReason)
+}
+
+func TestSuiteTiming(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	filesystem.Fs = afero.NewMemMapFs()
+	afero.WriteFile(filesystem.Fs, "manifest.json", []byte(`{
+		"name": "timing",
+		"timing": {"max_ms": 10},
+		"tests": [{"request": {"endpoint": "slow", "method": "GET"}}]
+	}`), 644)
+
+	r := report.NewReport()
+	suite, err := NewTestSuite(TestToolConfig{ServerURL: ts.URL}, "manifest.json", r.Root(), datastore.NewStore(false), 0)
+	go_test_utils.ExpectNoError(t, err, "error loading suite")
+
+	if suite.Run() {
+		t.Error("Expected suite to fail because of its timing")
+	}
+	if log := strings.Join(r.GetLog(), "\n"); !strings.Contains(log, "[timing.max_ms] suite took") {
+		t.Errorf("Expected timing failure in log, got: %s", log)
+	}
+}
+
+func TestSuiteCookieJar(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "sess", Value: r.URL.Query().Get("user"), Path: "/"})
+		case "/whoami":
+			user := ""
+			if c, err := r.Cookie("sess"); err == nil {
+				user = c.Value
+			}
+			w.Write([]byte(`{"user": "` + user + `"}`))
+		case "/echo":
+			w.Write([]byte(`{"v": "` + r.URL.Query().Get("v") + `"}`))
+		}
+	}))
+	defer ts.Close()
+
+	filesystem.Fs = afero.NewMemMapFs()
+	afero.WriteFile(filesystem.Fs, "manifest.json", []byte(`{
+		"name": "cookie jar",
+		"cookie_jar": true,
+		"tests": [
+			{"request": {"endpoint": "login", "method": "GET", "query_params": {"user": "admin"}}},
+			{"request": {"endpoint": "whoami", "method": "GET"}, "response": {"body": {"user": "admin"}}},
+			{"request": {"endpoint": "login", "method": "GET", "query_params": {"user": "editor"}, "cookie_jar": "editor"}},
+			{"request": {"endpoint": "whoami", "method": "GET", "cookie_jar": "editor"}, "response": {"body": {"user": "editor"}}},
+			{"request": {"endpoint": "whoami", "method": "GET"}, "response": {"body": {"user": "admin"}}},
+			"@jar.json"
+		]
+	}`), 644)
+	afero.WriteFile(filesystem.Fs, "jar.json", []byte(`{
+		"request": {"endpoint": "echo", "method": "GET", "query_params": {"v": {{ (cookie_jar "editor" "whoami").sess | marshal }}}},
+		"response": {"body": {"v": "editor"}}
+	}`), 644)
+
+	r := report.NewReport()
+	suite, err := NewTestSuite(TestToolConfig{ServerURL: ts.URL}, "manifest.json", r.Root(), datastore.NewStore(false), 0)
+	go_test_utils.ExpectNoError(t, err, "error loading suite")
+
+	if !suite.Run() {
+		t.Errorf("Expected suite to succeed, log: %s", strings.Join(r.GetLog(), "\n"))
+	}
+}
+
+func TestSuiteFilterNoMatch(t *testing.T) {
+	calls := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	filesystem.Fs = afero.NewMemMapFs()
+	afero.WriteFile(filesystem.Fs, "manifest.json", []byte(`{
+		"name": "filtered",
+		"before_all": [{"request": {"endpoint": "before_all", "method": "GET"}}],
+		"after_all": [{"request": {"endpoint": "after_all", "method": "GET"}}],
+		"tests": [{"name": "slow test", "tags": ["slow"], "request": {"endpoint": "test", "method": "GET"}}]
+	}`), 644)
+
+	filter, err := NewTestFilter([]string{"smoke"}, nil, "")
+	go_test_utils.ExpectNoError(t, err, "error creating filter")
+
+	r := report.NewReport()
+	suite, err := NewTestSuite(TestToolConfig{ServerURL: ts.URL, Filter: filter}, "manifest.json", r.Root(), datastore.NewStore(false), 0)
+	go_test_utils.ExpectNoError(t, err, "error loading suite")
+
+	if !suite.Run() {
+		t.Error("Expected filtered suite to succeed")
+	}
+	// No hooks are run for a suite without matching tests
+	go_test_utils.AssertIntEquals(t, 0, len(calls))
+	go_test_utils.AssertStringEquals(t, "no test matches --tags and --run", r.Root().SkipReason)
+}
+
+func TestSuiteFilterHooks(t *testing.T) {
+	calls := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	filesystem.Fs = afero.NewMemMapFs()
+	afero.WriteFile(filesystem.Fs, "manifest.json", []byte(`{
+		"name": "filtered",
+		"before_each": [{"request": {"endpoint": "before_each", "method": "GET"}}],
+		"after_each": [{"request": {"endpoint": "after_each", "method": "GET"}}],
+		"tests": [
+			{"name": "smoke test", "tags": ["smoke"], "request": {"endpoint": "a", "method": "GET"}},
+			{"name": "slow test", "tags": ["slow"], "request": {"endpoint": "b", "method": "GET"}}
+		]
+	}`), 644)
+
+	filter, err := NewTestFilter([]string{"smoke"}, nil, "")
+	go_test_utils.ExpectNoError(t, err, "error creating filter")
+
+	r := report.NewReport()
+	suite, err := NewTestSuite(TestToolConfig{ServerURL: ts.URL, Filter: filter}, "manifest.json", r.Root(), datastore.NewStore(false), 0)
+	go_test_utils.ExpectNoError(t, err, "error loading suite")
+
+	if !suite.Run() {
+		t.Errorf("Expected suite to succeed, log: %s", strings.Join(r.GetLog(), "\n"))
+	}
+	// The hooks are only run around the test that matches
+	go_test_utils.AssertStringEquals(t, "/before_each /a /after_each", strings.Join(calls, " "))
+}
+
+func TestSuiteSkipIfHooks(t *testing.T) {
+	calls := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	filesystem.Fs = afero.NewMemMapFs()
+	afero.WriteFile(filesystem.Fs, "manifest.json", []byte(`{
+		"name": "conditions",
+		"before_each": [{"request": {"endpoint": "before_each", "method": "GET"}}],
+		"after_each": [{"request": {"endpoint": "after_each", "method": "GET"}}],
+		"tests": [
+			{"name": "skipped", "skip_if": "true", "request": {"endpoint": "a", "method": "GET"}},
+			{"name": "not run", "run_if": "false", "request": {"endpoint": "b", "method": "GET"}},
+			{"name": "run", "run_if": "true", "request": {"endpoint": "c", "method": "GET"}}
+		]
+	}`), 644)
+
+	r := report.NewReport()
+	suite, err := NewTestSuite(TestToolConfig{ServerURL: ts.URL}, "manifest.json", r.Root(), datastore.NewStore(false), 0)
+	go_test_utils.ExpectNoError(t, err, "error loading suite")
+
+	if !suite.Run() {
+		t.Errorf("Expected suite to succeed, log: %s", strings.Join(r.GetLog(), "\n"))
+	}
+	// The hooks are only run around the test that is not skipped
+	go_test_utils.AssertStringEquals(t, "/before_each /c /after_each", strings.Join(calls, " "))
+}
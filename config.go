@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/programmfabrik/apitest/pkg/lib/api"
 	"github.com/programmfabrik/apitest/pkg/lib/filesystem"
 	"github.com/programmfabrik/apitest/pkg/lib/util"
 
@@ -28,6 +29,7 @@ type ConfigStruct struct {
 			Format string `mapstructure:"format"`
 		} `mapstructure:"report"`
 		OAuthClient util.OAuthClientsConfig `mapstructure:"oauth_client"`
+		HTTP        api.ClientConfig        `mapstructure:"http"`
 	}
 }
 
@@ -49,6 +51,8 @@ func LoadConfig(cfgFile string) {
 	}
 
 	viper.Unmarshal(&Config)
+
+	api.SetDefaultClientConfig(Config.Apitest.HTTP)
 }
 
 // TestToolConfig gives us the basic testtool infos
@@ -59,6 +63,9 @@ type TestToolConfig struct {
 	LogNetwork      bool
 	LogVerbose      bool
 	OAuthClient     util.OAuthClientsConfig
+	Filter          TestFilter
+	Retries         int
+	DryRun          bool
 }
 
 // NewTestToolConfig is mostly used for testing purpose. We can setup our config with this function
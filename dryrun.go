@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/programmfabrik/apitest/pkg/lib/api"
+	"github.com/programmfabrik/apitest/pkg/lib/cjson"
+	"github.com/programmfabrik/apitest/pkg/lib/template"
+	"github.com/programmfabrik/apitest/pkg/lib/util"
+	"github.com/sirupsen/logrus"
+)
+
+// DryRun loads all tests of the suite, including hooks and external files, and
+// renders their requests and responses without sending anything. Every problem
+// is logged with the file it was found in
+func (ats *Suite) DryRun() bool {
+	logrus.Infof("[%2d] '%s' (dry run)", ats.index, ats.Name)
+
+	dr := dryRunner{suite: ats}
+	dr.visit = dr.check
+	for _, tests := range [][]interface{}{ats.BeforeAll, ats.BeforeEach, ats.Tests, ats.AfterEach, ats.AfterAll} {
+		for _, v := range tests {
+			dr.test(v, ats.manifestDir, ats.manifestPath)
+		}
+	}
+
+	success := len(dr.errors) == 0
+	if success {
+		logrus.Infof("[%2d] %d tests checked", ats.index, dr.cases)
+	} else {
+		logrus.Warnf("[%2d] %d tests checked, %d errors", ats.index, dr.cases, len(dr.errors))
+	}
+
+	return success
+}
+
+// dryRunner loads the tests of a suite without running them and collects the
+// errors. It follows the same steps as parseAndRunTest
+type dryRunner struct {
+	suite  *Suite
+	cases  int
+	errors []string
+	// visit is called for every test that could be loaded, with its json
+	visit func(test Case, caseBytes []byte, testFilePath string)
+}
+
+func (dr *dryRunner) fail(file string, err error) {
+	msg := fmt.Sprintf("%s: %s", file, err)
+	logrus.Error(msg)
+	dr.suite.reporterRoot.SaveToReportLog(msg)
+	dr.errors = append(dr.errors, msg)
+}
+
+func (dr *dryRunner) test(v interface{}, manifestDir, testFilePath string) {
+	loader, err := dr.suite.newLoader()
+	if err != nil {
+		dr.fail(testFilePath, err)
+		return
+	}
+
+	fileh, testObj, err := template.LoadManifestDataAsRawJson(v, manifestDir)
+	dir := filepath.Dir(fileh)
+	if fileh != "" {
+		testFilePath = filepath.Join(filepath.Dir(testFilePath), fileh)
+	}
+	if err != nil {
+		dr.fail(testFilePath, err)
+		return
+	}
+
+	var testCases []json.RawMessage
+	err = cjson.Unmarshal(testObj, &testCases)
+	if err == nil {
+		for _, tc := range testCases {
+			if util.IsPathSpec(tc) {
+				var sS string
+				err := cjson.Unmarshal(tc, &sS)
+				if err != nil {
+					dr.fail(testFilePath, err)
+					continue
+				}
+				dr.test(sS, filepath.Join(manifestDir, dir), testFilePath)
+			} else {
+				dr.testCase(tc, filepath.Join(manifestDir, dir), testFilePath, loader)
+			}
+		}
+		return
+	}
+
+	requestBytes, err := loader.Render(testObj, filepath.Join(manifestDir, dir), nil)
+	if err != nil {
+		dr.fail(testFilePath, fmt.Errorf("can not render template: %s", err))
+		return
+	}
+	if string(requestBytes) != string(testObj) {
+		dr.test(requestBytes, filepath.Join(manifestDir, dir), testFilePath)
+		return
+	}
+
+	var singleTest json.RawMessage
+	err = cjson.Unmarshal(testObj, &singleTest)
+	if err != nil {
+		dr.fail(testFilePath, err)
+		return
+	}
+	if util.IsPathSpec(testObj) {
+		var sS string
+		err := cjson.Unmarshal(testObj, &sS)
+		if err != nil {
+			dr.fail(testFilePath, err)
+			return
+		}
+		dr.test(sS, filepath.Join(manifestDir, dir), testFilePath)
+		return
+	}
+	dr.testCase(testObj, filepath.Join(manifestDir, dir), testFilePath, loader)
+}
+
+// testCase loads a single test like runSingleTest does and passes it to visit
+func (dr *dryRunner) testCase(caseBytes []byte, manifestDir, testFilePath string, loader template.Loader) {
+	dr.cases++
+
+	var test Case
+	err := cjson.Unmarshal(caseBytes, &test)
+	if err != nil {
+		dr.fail(testFilePath, fmt.Errorf("can not unmarshal test: %s", err))
+		return
+	}
+	if test.Name == "" {
+		test.Name = "<no name>"
+	}
+	test.Filename = testFilePath
+	test.loader = loader
+	test.manifestDir = manifestDir
+	test.dataStore = dr.suite.datastore
+	test.cookieJars = dr.suite.cookieJars
+	test.cookieJar = dr.suite.defaultCookieJar()
+	test.standardHeader = dr.suite.StandardHeader
+	test.standardHeaderFromStore = dr.suite.StandardHeaderFromStore
+	if test.ServerURL == "" {
+		test.ServerURL = dr.suite.Config.ServerURL
+	}
+
+	// Later tests might use the stored values
+	err = test.dataStore.SetMap(test.Store)
+	if err != nil {
+		dr.fail(testFilePath, fmt.Errorf("'%s': error setting datastore map: %s", test.Name, err))
+	}
+
+	dr.visit(test, caseBytes, testFilePath)
+}
+
+// check renders the request and all responses of a test and decodes them
+// strictly, so unknown keys are found as well
+func (dr *dryRunner) check(test Case, caseBytes []byte, testFilePath string) {
+	// The specs are decoded from the json as it is written, not from the loaded
+	// data, so the positions in errors match the file
+	fields := map[string]json.RawMessage{}
+	_ = cjson.Unmarshal(caseBytes, &fields)
+
+	specs := []dryRunSpec{}
+	if test.RequestData != nil {
+		specs = append(specs, dryRunSpec{"request", *test.RequestData, &api.Request{}})
+	}
+	if test.WebSocketData != nil {
+		specs = append(specs, dryRunSpec{"websocket", *test.WebSocketData, &CaseWebSocket{}})
+	}
+	for _, res := range test.responses() {
+		specs = append(specs, dryRunSpec{res.key, res.data, &api.ResponseSerialization{}})
+	}
+
+	for _, spec := range specs {
+		file, specBytes, err := loadSpec(test, spec.data, inPlace(caseBytes, rawSpec(fields, spec.key)))
+		specFilePath := testFilePath
+		if file != "" {
+			specFilePath = filepath.Join(filepath.Dir(testFilePath), file)
+		}
+		if err != nil {
+			dr.fail(specFilePath, fmt.Errorf("'%s': error loading %s: %s", test.Name, spec.key, err))
+			continue
+		}
+		err = cjson.Unmarshal(specBytes, spec.target)
+		if err != nil {
+			dr.fail(specFilePath, fmt.Errorf("'%s': invalid %s: %s", test.Name, spec.key, err))
+		}
+	}
+}
+
+// dryRunSpec is a request or response of a test, with the struct to decode it into
+type dryRunSpec struct {
+	key    string
+	data   interface{}
+	target interface{}
+}
+
+// loadSpec returns the json of a spec. A path spec is rendered like
+// LoadManifestDataAsObject does and returned with its file, an inline spec is
+// returned as it is written in the test
+func loadSpec(test Case, data interface{}, raw json.RawMessage) (string, []byte, error) {
+	pathSpec, ok := data.(string)
+	if !ok {
+		if raw == nil {
+			return "", nil, fmt.Errorf("specification needs to be string[@...] or jsonObject but is: %v", data)
+		}
+		return "", raw, nil
+	}
+	file, tmpl, err := template.LoadManifestDataAsRawJson(pathSpec, test.manifestDir)
+	if err != nil {
+		return file, nil, err
+	}
+	specBytes, err := test.loader.Render(tmpl, test.manifestDir, nil)
+	if err != nil {
+		return file, nil, fmt.Errorf("error rendering: %s", err)
+	}
+	return file, specBytes, nil
+}
+
+// rawSpec returns the json of a spec in the test, by its key like "response"
+// or "break_response[1]"
+func rawSpec(fields map[string]json.RawMessage, key string) json.RawMessage {
+	i := strings.Index(key, "[")
+	if i < 0 {
+		return fields[key]
+	}
+	var idx int
+	fmt.Sscanf(key[i:], "[%d]", &idx)
+	var list []json.RawMessage
+	err := json.Unmarshal(fields[key[:i]], &list)
+	if err != nil || idx >= len(list) {
+		return nil
+	}
+	return list[idx]
+}
+
+type namedResponse struct {
+	key  string
+	data interface{}
+}
+
+// responses returns all expected responses of the test with their manifest keys
+func (testCase Case) responses() []namedResponse {
+	responses := []namedResponse{}
+	if testCase.ResponseData != nil {
+		responses = append(responses, namedResponse{"response", testCase.ResponseData})
+	}
+	for i, v := range testCase.BreakResponse {
+		responses = append(responses, namedResponse{fmt.Sprintf("break_response[%d]", i), v})
+	}
+	if collect, ok := testCase.CollectResponse.(util.JsonArray); ok {
+		for i, v := range collect {
+			responses = append(responses, namedResponse{fmt.Sprintf("collect_response[%d]", i), v})
+		}
+	} else if testCase.CollectResponse != nil {
+		responses = append(responses, namedResponse{"collect_response", testCase.CollectResponse})
+	}
+	return responses
+}
+
+// inPlace puts the newlines before an inline spec in the test in front of it,
+// so the lines in errors are the lines of the test
+func inPlace(caseBytes []byte, raw json.RawMessage) json.RawMessage {
+	idx := bytes.Index(caseBytes, raw)
+	if raw == nil || idx < 0 {
+		return raw
+	}
+	return append(bytes.Repeat([]byte("\n"), bytes.Count(caseBytes[:idx], []byte("\n"))), raw...)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/programmfabrik/apitest/pkg/lib/datastore"
+	"github.com/programmfabrik/apitest/pkg/lib/filesystem"
+	"github.com/programmfabrik/apitest/pkg/lib/report"
+	go_test_utils "github.com/programmfabrik/go-test-utils"
+	"github.com/spf13/afero"
+)
+
+func TestSuiteDryRun(t *testing.T) {
+	filesystem.Fs = afero.NewMemMapFs()
+	afero.WriteFile(filesystem.Fs, "manifest.json", []byte(`{
+		"name": "dry run",
+		"before_all": [{"request": {"endpoint": "login", "method": "POST"}, "store_response_qjson": {"token": "body.token"}}],
+		"tests": [
+			"@cases.json",
+			{
+				"name": "stored values",
+				"request": {"endpoint": "a", "method": "GET", "header": {"token": {{ datastore "token" | marshal }}}},
+				"response": {"body": {"id": {{ datastore -1 | qjson "body.id" }}}}
+			}
+		]
+	}`), 644)
+	afero.WriteFile(filesystem.Fs, "cases.json", []byte(`[
+		{"name": "ok", "request": {"endpoint": "a", "method": "GET"}},
+		{"name": "typo", "request": {"endpoint": "a", "methdo": "GET"}},
+		{"name": "bad response", "request": {"endpoint": "a"}, "response": {"status_code": 200}},
+		"@template.json"
+	]`), 644)
+	afero.WriteFile(filesystem.Fs, "template.json", []byte(`{
+		"name": "template",
+		"request": {"endpoint": "{{ nosuchfunc }}"}
+	}`), 644)
+
+	r := report.NewReport()
+	suite, err := NewTestSuite(TestToolConfig{DryRun: true}, "manifest.json", r.Root(), datastore.NewStore(false), 0)
+	go_test_utils.ExpectNoError(t, err, "error loading suite")
+
+	if suite.DryRun() {
+		t.Error("Expected dry run to fail")
+	}
+
+	log := r.GetLog()
+	go_test_utils.AssertIntEquals(t, 3, len(log))
+	expected := []string{
+		`cases.json: 'typo': invalid request:`,
+		`cases.json: 'bad response': invalid response:`,
+		`template.json: can not render template:`,
+	}
+	for i, e := range expected {
+		if !strings.Contains(log[i], e) {
+			t.Errorf("Expected log %d to contain '%s', got: %s", i, e, log[i])
+		}
+	}
+}
+
+func TestDryRunErrorPositions(t *testing.T) {
+	filesystem.Fs = afero.NewMemMapFs()
+	afero.WriteFile(filesystem.Fs, "manifest.json", []byte(`{
+		"name": "positions",
+		"tests": ["@case.json"]
+	}`), 644)
+	afero.WriteFile(filesystem.Fs, "case.json", []byte(`{
+	"name": "files",
+	"request": "@request.json",
+	"break_response": [
+		{"statuscode": 200},
+		{
+			"statuscode": 200,
+			"header": {},
+			"bdoy": {}
+		}
+	]
+}`), 644)
+	afero.WriteFile(filesystem.Fs, "request.json", []byte(`{
+	{{/* a comment that is not in the rendered json */}}
+	"endpoint": "a",
+	"methdo": "GET"
+}`), 644)
+
+	r := report.NewReport()
+	suite, err := NewTestSuite(TestToolConfig{DryRun: true}, "manifest.json", r.Root(), datastore.NewStore(false), 0)
+	go_test_utils.ExpectNoError(t, err, "error loading suite")
+
+	if suite.DryRun() {
+		t.Error("Expected dry run to fail")
+	}
+
+	// The lines are counted in the rendered request file and in the test file
+	log := r.GetLog()
+	go_test_utils.AssertIntEquals(t, 2, len(log))
+	expected := [][]string{
+		{`request.json: 'files': invalid request:`, `line 4, character`},
+		{`case.json: 'files': invalid break_response[1]:`, `line 9, character`},
+	}
+	for i, e := range expected {
+		if !strings.Contains(log[i], e[0]) || !strings.Contains(log[i], e[1]) {
+			t.Errorf("Expected log %d to contain '%s' and '%s', got: %s", i, e[0], e[1], log[i])
+		}
+	}
+}
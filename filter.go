@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/programmfabrik/apitest/pkg/lib/template"
+	"github.com/programmfabrik/apitest/pkg/lib/util"
+)
+
+// TestFilter selects the suites and cases to run by their tags and names
+type TestFilter struct {
+	Tags     []string
+	SkipTags []string
+	Run      *regexp.Regexp
+}
+
+// NewTestFilter creates the filter from the command line values
+func NewTestFilter(tags, skipTags []string, run string) (filter TestFilter, err error) {
+	filter = TestFilter{
+		Tags:     tags,
+		SkipTags: skipTags,
+	}
+	if run != "" {
+		filter.Run, err = regexp.Compile(run)
+		if err != nil {
+			return filter, fmt.Errorf("invalid --run pattern '%s': %s", run, err)
+		}
+	}
+	return filter, nil
+}
+
+// suiteSkipReason tells why a whole suite is filtered out, so its http server and
+// hooks are not run. That is the case for --skip-tags on the suite, or if no test
+// of the suite can match. Tests in external files are not loaded yet, so they
+// might always match
+func (filter TestFilter) suiteSkipReason(suiteName string, suiteTags []string, tests []interface{}) string {
+	if tag := firstCommonTag(suiteTags, filter.SkipTags); tag != "" {
+		return fmt.Sprintf("tag '%s' is in --skip-tags", tag)
+	}
+	if len(filter.Tags) == 0 && filter.Run == nil {
+		return ""
+	}
+	for _, v := range tests {
+		test, ok := v.(util.JsonObject)
+		if !ok {
+			return ""
+		}
+		name, tags := nameAndTags(test)
+		if filter.caseSkipReason(suiteName, name, suiteTags, tags) == "" {
+			return ""
+		}
+	}
+	return "no test matches --tags and --run"
+}
+
+// nameAndTags reads the name and tags of a test that was not loaded yet
+func nameAndTags(test util.JsonObject) (name string, tags []string) {
+	name, _ = test["name"].(string)
+	tagValues, _ := test["tags"].([]interface{})
+	for _, t := range tagValues {
+		if tag, ok := t.(string); ok {
+			tags = append(tags, tag)
+		}
+	}
+	return name, tags
+}
+
+// caseSkipReason tells why a case is filtered out, or returns "" if it should run.
+// Cases inherit the tags of their suite, --run matches the suite or the case name
+func (filter TestFilter) caseSkipReason(suiteName, caseName string, suiteTags, caseTags []string) string {
+	tags := append(append([]string{}, suiteTags...), caseTags...)
+
+	if tag := firstCommonTag(tags, filter.SkipTags); tag != "" {
+		return fmt.Sprintf("tag '%s' is in --skip-tags", tag)
+	}
+	if len(filter.Tags) > 0 && firstCommonTag(tags, filter.Tags) == "" {
+		return "no tag is in --tags"
+	}
+	if filter.Run != nil && !filter.Run.MatchString(suiteName) && !filter.Run.MatchString(caseName) {
+		return fmt.Sprintf("name does not match --run '%s'", filter.Run)
+	}
+	return ""
+}
+
+func firstCommonTag(tags, other []string) string {
+	for _, t := range tags {
+		for _, o := range other {
+			if t == o {
+				return t
+			}
+		}
+	}
+	return ""
+}
+
+// conditionSkipReason evaluates the skip_if and run_if expressions of a suite or case
+// and tells why it is skipped, or returns "" if it should run
+func conditionSkipReason(loader template.Loader, rootDir, skipIf, runIf string) (string, error) {
+	if skipIf != "" {
+		skip, err := loader.Condition(skipIf, rootDir)
+		if err != nil {
+			return "", fmt.Errorf("error evaluating skip_if '%s': %s", skipIf, err)
+		}
+		if skip {
+			return fmt.Sprintf("skip_if '%s' is true", skipIf), nil
+		}
+	}
+	if runIf != "" {
+		run, err := loader.Condition(runIf, rootDir)
+		if err != nil {
+			return "", fmt.Errorf("error evaluating run_if '%s': %s", runIf, err)
+		}
+		if !run {
+			return fmt.Sprintf("run_if '%s' is false", runIf), nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	go_test_utils "github.com/programmfabrik/go-test-utils"
+)
+
+func TestTestFilter(t *testing.T) {
+	filter, err := NewTestFilter([]string{"smoke"}, []string{"slow"}, "^login")
+	go_test_utils.ExpectNoError(t, err, "error creating filter")
+
+	tests := []struct {
+		suiteName, caseName string
+		suiteTags, caseTags []string
+		skipped             bool
+	}{
+		{"login suite", "first", []string{"smoke"}, nil, false},
+		{"users", "login as root", nil, []string{"smoke"}, false},
+		{"users", "login as root", nil, nil, true},
+		{"users", "logout", nil, []string{"smoke"}, true},
+		{"login suite", "first", []string{"smoke"}, []string{"slow"}, true},
+	}
+
+	for _, tc := range tests {
+		reason := filter.caseSkipReason(tc.suiteName, tc.caseName, tc.suiteTags, tc.caseTags)
+		if (reason != "") != tc.skipped {
+			t.Errorf("%s/%s: expected skipped=%v, got reason '%s'", tc.suiteName, tc.caseName, tc.skipped, reason)
+		}
+	}
+
+	go_test_utils.AssertStringEquals(t, "tag 'slow' is in --skip-tags", filter.suiteSkipReason("users", []string{"a", "slow"}, nil))
+
+	suiteTests := []struct {
+		suiteName string
+		tests     []interface{}
+		reason    string
+	}{
+		{"users", []interface{}{map[string]interface{}{"name": "login as root", "tags": []interface{}{"smoke"}}}, ""},
+		{"users", []interface{}{map[string]interface{}{"name": "logout", "tags": []interface{}{"smoke"}}}, "no test matches --tags and --run"},
+		{"users", []interface{}{map[string]interface{}{"name": "login as root"}}, "no test matches --tags and --run"},
+		{"users", nil, "no test matches --tags and --run"},
+		// External tests are not loaded, so they might match
+		{"users", []interface{}{"@login.json"}, ""},
+	}
+	for _, tc := range suiteTests {
+		go_test_utils.AssertStringEquals(t, tc.reason, filter.suiteSkipReason(tc.suiteName, []string{"a"}, tc.tests))
+	}
+
+	// Without --tags and --run every suite runs
+	go_test_utils.AssertStringEquals(t, "", TestFilter{}.suiteSkipReason("users", nil, nil))
+
+	_, err = NewTestFilter(nil, nil, "(")
+	go_test_utils.ExpectError(t, err, "expected error for invalid --run pattern")
+}
@@ -4,6 +4,9 @@ go 1.13
 
 require (
 	github.com/clbanning/mxj v1.8.4
+	github.com/fsnotify/fsnotify v1.4.7
+	github.com/golang/protobuf v1.3.2
+	github.com/jhump/protoreflect v1.6.0
 	github.com/mattn/go-sqlite3 v1.14.4
 	github.com/moul/http2curl v1.0.0
 	github.com/pkg/errors v0.8.1
@@ -15,6 +18,8 @@ require (
 	github.com/spf13/cobra v0.0.5
 	github.com/spf13/viper v1.5.0
 	github.com/tidwall/gjson v1.3.4
+	golang.org/x/net v0.0.0-20190522155817-f3200d17e092
 	golang.org/x/oauth2 v0.0.0-20180821212333-d2e6202438be
 	golang.org/x/sys v0.0.0-20200223170610-d5e6a3e2c0ae // indirect
+	google.golang.org/grpc v1.27.1
 )
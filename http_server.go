@@ -13,6 +13,9 @@ import (
 
 	"github.com/programmfabrik/apitest/internal/httpproxy"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.org/x/net/websocket"
 )
 
 // StartHttpServer start a simple http server that can server local test resources during the testsuite is running
@@ -41,13 +44,22 @@ func (ats *Suite) StartHttpServer() {
 	// bounce query response with query in response body, as it is
 	mux.Handle("/bounce-query", logH(http.HandlerFunc(bounceQuery)))
 
+	// websocket that sends back every message it receives
+	mux.Handle("/ws-echo", logH(websocket.Server{Handler: wsEcho}))
+
 	// Start listening into proxy
 	ats.httpServerProxy = httpproxy.New(ats.HttpServer.Proxy)
 	ats.httpServerProxy.RegisterRoutes(mux, "/")
 
+	var handler http.Handler = mux
+	if ats.HttpServer.H2C {
+		// Serve HTTP/2 without TLS next to HTTP/1.1
+		handler = h2c.NewHandler(mux, &http2.Server{})
+	}
+
 	ats.httpServer = http.Server{
 		Addr:    ats.HttpServer.Addr,
-		Handler: mux,
+		Handler: handler,
 	}
 
 	run := func() {
@@ -206,6 +218,11 @@ func bounceQuery(w http.ResponseWriter, r *http.Request) {
 	io.Copy(w, rBody)
 }
 
+// wsEcho sends back the messages of the websocket connection until it is closed
+func wsEcho(ws *websocket.Conn) {
+	io.Copy(ws, ws)
+}
+
 func cookiesMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ckHeader := r.Header.Values("X-Test-Set-Cookies")
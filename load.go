@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/programmfabrik/apitest/pkg/lib/api"
+	"github.com/programmfabrik/apitest/pkg/lib/report"
+	"github.com/sirupsen/logrus"
+)
+
+// CaseLoad replays the request of a test concurrently, until either the number
+// of iterations is sent or the duration is over
+type CaseLoad struct {
+	Concurrency int `json:"concurrency"`
+	Iterations  int `json:"iterations"`
+	DurationS   int `json:"duration_s"`
+	// Share of failed requests (0 to 1) that is still a success (default: 0)
+	MaxErrorRate float64 `json:"max_error_rate"`
+}
+
+// loadResponse is the outcome of a single request of a load test
+type loadResponse struct {
+	duration time.Duration
+	err      error
+	failures []string
+}
+
+// runLoad renders the request and the expected response once and sends the
+// request according to the load block. Every response is checked, but not stored.
+// A load block is never retried, its error rate already covers single failures
+func (testCase Case) runLoad() (bool, error) {
+	load := testCase.Load
+	r := testCase.ReportElem
+
+	if load.Iterations <= 0 && load.DurationS <= 0 {
+		return false, fmt.Errorf("load needs iterations or duration_s")
+	}
+	concurrency := load.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	// The store of the test is visible to the templates, like for a single request
+	err := testCase.dataStore.SetMap(testCase.Store)
+	if err != nil {
+		return false, fmt.Errorf("error setting datastore map:%s", err)
+	}
+
+	req, err := testCase.loadRequest()
+	if err != nil {
+		return false, fmt.Errorf("error loading request: %s", err)
+	}
+	expectedResponse, err := testCase.loadResponse()
+	if err != nil {
+		return false, fmt.Errorf("error loading response: %s", err)
+	}
+	req.ResponseFormat = expectedResponse.Format
+
+	var deadline time.Time
+	if load.DurationS > 0 {
+		deadline = time.Now().Add(time.Duration(load.DurationS) * time.Second)
+	}
+
+	var (
+		wg        sync.WaitGroup
+		m         sync.Mutex
+		responses []loadResponse
+	)
+
+	// next hands out the permission to send one more request
+	sent := 0
+	next := func() bool {
+		m.Lock()
+		defer m.Unlock()
+
+		if load.Iterations > 0 && sent >= load.Iterations {
+			return false
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return false
+		}
+		sent++
+		return true
+	}
+
+	start := time.Now()
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for next() {
+				res := testCase.sendLoadRequest(req, expectedResponse)
+
+				m.Lock()
+				responses = append(responses, res)
+				m.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	result := loadResult(responses, time.Since(start))
+	r.SetLoadResult(result)
+
+	msg := fmt.Sprintf("load: %d requests (%.1f/s), %d errors, %d failed, p50 %.1fms, p90 %.1fms, p99 %.1fms",
+		result.Requests, result.RequestsPerSecond, result.Errors, result.Failed, result.P50Ms, result.P90Ms, result.P99Ms)
+	logrus.Infof("     [%2d] %s", testCase.index, msg)
+	r.SaveToReportLog(msg)
+
+	if result.ErrorRate <= load.MaxErrorRate {
+		return true, nil
+	}
+
+	// Show what went wrong with the first failed request
+	for _, res := range responses {
+		if res.err != nil {
+			r.SaveToReportLog(res.err.Error())
+			break
+		}
+		if len(res.failures) > 0 {
+			for _, f := range res.failures {
+				r.SaveToReportLog(f)
+			}
+			break
+		}
+	}
+	r.SaveToReportLogF("Error rate %.3f is above max_error_rate %.3f", result.ErrorRate, load.MaxErrorRate)
+	logrus.Errorf("Error rate %.3f is above max_error_rate %.3f", result.ErrorRate, load.MaxErrorRate)
+
+	return false, nil
+}
+
+func (testCase Case) sendLoadRequest(req api.Request, expectedResponse api.Response) (res loadResponse) {
+	start := time.Now()
+	apiResp, err := req.Send()
+	res.duration = time.Since(start)
+	if err != nil {
+		res.err = fmt.Errorf("error sending request: %s", err)
+		return res
+	}
+
+	apiResp.Format = expectedResponse.Format
+	responsesMatch, err := testCase.responsesEqual(expectedResponse, apiResp)
+	if err != nil {
+		res.err = fmt.Errorf("error matching responses: %s", err)
+		return res
+	}
+	if failure := timingFailure(expectedResponse.Timing(), apiResp.Duration(), "request"); failure != nil {
+		responsesMatch.Failures = append(responsesMatch.Failures, *failure)
+	}
+	if failure := graphQLErrorsFailure(req, expectedResponse, apiResp); failure != nil {
+		responsesMatch.Failures = append(responsesMatch.Failures, *failure)
+	}
+	for _, f := range responsesMatch.Failures {
+		res.failures = append(res.failures, f.String())
+	}
+	return res
+}
+
+func loadResult(responses []loadResponse, elapsed time.Duration) *report.LoadResult {
+	result := &report.LoadResult{Requests: len(responses)}
+	if len(responses) == 0 {
+		return result
+	}
+
+	durations := make([]time.Duration, 0, len(responses))
+	for _, res := range responses {
+		durations = append(durations, res.duration)
+		if res.err != nil {
+			result.Errors++
+		} else if len(res.failures) > 0 {
+			result.Failed++
+		}
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+	result.ErrorRate = float64(result.Errors+result.Failed) / float64(len(responses))
+	result.RequestsPerSecond = float64(len(responses)) / elapsed.Seconds()
+	result.P50Ms = percentileMs(durations, 50)
+	result.P90Ms = percentileMs(durations, 90)
+	result.P99Ms = percentileMs(durations, 99)
+	result.MaxMs = percentileMs(durations, 100)
+
+	return result
+}
+
+// percentileMs returns the nearest-rank percentile of the sorted durations in milliseconds
+func percentileMs(sorted []time.Duration, p float64) float64 {
+	idx := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return float64(sorted[idx]) / float64(time.Millisecond)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/programmfabrik/apitest/pkg/lib/datastore"
+	"github.com/programmfabrik/apitest/pkg/lib/report"
+	"github.com/programmfabrik/apitest/pkg/lib/template"
+	go_test_utils "github.com/programmfabrik/go-test-utils"
+)
+
+func TestLoad(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1)%4 == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		load    string
+		success bool
+	}{
+		{`{"concurrency": 4, "iterations": 20}`, false},
+		{`{"concurrency": 4, "iterations": 20, "max_error_rate": 0.3}`, true},
+	}
+
+	for _, tc := range tests {
+		atomic.StoreInt32(&requests, 0)
+		r := report.NewReport()
+
+		manifest := `{"request": {"endpoint": "a", "method": "GET"}, "response": {"statuscode": 200}, "load": ` + tc.load + `}`
+		var test Case
+		err := json.Unmarshal([]byte(manifest), &test)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.ServerURL = ts.URL
+		test.dataStore = datastore.NewStore(false)
+		test.loader = template.NewLoader(test.dataStore)
+
+		if test.runAPITestCase(r.Root()) != tc.success {
+			t.Errorf("%s: expected success=%v", tc.load, tc.success)
+		}
+
+		result := r.Root().SubTests[0].Load
+		if result == nil {
+			t.Fatalf("%s: no load result in report", tc.load)
+		}
+		go_test_utils.AssertIntEquals(t, 20, int(atomic.LoadInt32(&requests)))
+		go_test_utils.AssertIntEquals(t, 20, result.Requests)
+		go_test_utils.AssertIntEquals(t, 5, result.Failed)
+		go_test_utils.AssertIntEquals(t, 0, result.Errors)
+		if result.ErrorRate != 0.25 {
+			t.Errorf("%s: expected error rate 0.25, got %f", tc.load, result.ErrorRate)
+		}
+	}
+}
+
+func TestLoadStoreAndRetry(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Header.Get("X-Value") != "stored" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	// The header comes from the store of the test, a failed load block is not retried
+	manifest := `{
+		"store": {"value": "stored"},
+		"request": {"endpoint": "load", "method": "GET", "header_from_store": {"X-Value": "value"}},
+		"response": {"statuscode": 200},
+		"load": {"iterations": 3},
+		"retry": {"count": 2}
+	}`
+	for _, success := range []bool{true, false} {
+		atomic.StoreInt32(&requests, 0)
+		var test Case
+		err := json.Unmarshal([]byte(manifest), &test)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !success {
+			test.Store["value"] = "other"
+		}
+		test.ServerURL = ts.URL
+		test.dataStore = datastore.NewStore(false)
+		test.loader = template.NewLoader(test.dataStore)
+
+		if test.runAPITestCase(report.NewReport().Root()) != success {
+			t.Errorf("expected success=%v", success)
+		}
+		go_test_utils.AssertIntEquals(t, 3, int(atomic.LoadInt32(&requests)))
+	}
+}
+
+func TestPercentileMs(t *testing.T) {
+	durations := []time.Duration{}
+	for i := 1; i <= 100; i++ {
+		durations = append(durations, time.Duration(i)*time.Millisecond)
+	}
+
+	tests := map[float64]float64{50: 50, 90: 90, 99: 99, 100: 100, 0: 1}
+	for p, exp := range tests {
+		if got := percentileMs(durations, p); got != exp {
+			t.Errorf("p%v: expected %vms, got %vms", p, exp, got)
+		}
+	}
+}
@@ -16,10 +16,13 @@ import (
 )
 
 var (
-	reportFormat, reportFile, serverURL, httpServerReplaceHost              string
+	reportFormat, reportFile, serverURL, httpServerReplaceHost, runPattern  string
+	rerunFailed                                                             string
 	logNetwork, logDatastore, logVerbose, logTimeStamp, logCurl, stopOnFail bool
-	rootDirectorys, singleTests                                             []string
+	watch, dryRun                                                           bool
+	rootDirectorys, singleTests, tags, skipTags                             []string
 	limitRequest, limitResponse                                             uint
+	parallelSuites, retries                                                 int
 )
 
 func init() {
@@ -41,6 +44,22 @@ func init() {
 		&singleTests, "single", "s", []string{},
 		"path to a single manifest. Runs only that specified testsuite")
 
+	testCMD.PersistentFlags().StringSliceVar(
+		&tags, "tags", []string{},
+		"Only run tests that have at least one of the given tags. Tests inherit the tags of their suite")
+
+	testCMD.PersistentFlags().StringSliceVar(
+		&skipTags, "skip-tags", []string{},
+		"Skip tests and suites that have any of the given tags")
+
+	testCMD.PersistentFlags().StringVar(
+		&runPattern, "run", "",
+		"Only run tests whose name or suite name matches the given regular expression")
+
+	testCMD.PersistentFlags().StringVar(
+		&rerunFailed, "rerun-failed", "",
+		"Only run the test suites that failed in the given json report of an earlier run")
+
 	testCMD.PersistentFlags().BoolVarP(
 		&logNetwork, "log-network", "n", false,
 		"log all network traffic to console")
@@ -78,6 +97,22 @@ func init() {
 		&stopOnFail, "stop-on-fail", false,
 		"Stop execution of later test suites if a test suite fails")
 
+	testCMD.PersistentFlags().BoolVar(
+		&dryRun, "dry-run", false,
+		"Load all manifests and render their requests and responses without sending anything")
+
+	testCMD.PersistentFlags().BoolVar(
+		&watch, "watch", false,
+		"Keep running and rerun test suites when their manifests or loaded files change")
+
+	testCMD.PersistentFlags().IntVar(
+		&parallelSuites, "parallel-suites", 1,
+		"Run up to n test suites in parallel. Suites marked as exclusive always run alone")
+
+	testCMD.PersistentFlags().IntVar(
+		&retries, "retries", 0,
+		"Retry failed tests up to n times. A retry defined in the test overwrites this")
+
 	// Bind the flags to overwrite the yml config if they are set
 	viper.BindPFlag("apitest.report.file", testCMD.PersistentFlags().Lookup("report-file"))
 	viper.BindPFlag("apitest.report.format", testCMD.PersistentFlags().Lookup("report-format"))
@@ -148,9 +183,17 @@ func runApiTests(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	testToolConfig.Retries = retries
+	testToolConfig.DryRun = dryRun
+	testToolConfig.Filter, err = NewTestFilter(tags, skipTags, runPattern)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
 	// Actually run the tests
 	// Run test function
-	runSingleTest := func(manifestPath string, reportElem *report.ReportElement) (success bool) {
+	locks := newSuiteLocks()
+	runSingleTest := func(manifestPath string, reportElem *report.ReportElement, idx int) (success bool) {
 		store := datastore.NewStore(logVerbose || logDatastore)
 		for k, v := range Config.Apitest.StoreInit {
 			err := store.Set(k, v)
@@ -159,51 +202,89 @@ func runApiTests(cmd *cobra.Command, args []string) {
 			}
 		}
 
-		suite, err := NewTestSuite(testToolConfig, manifestPath, reportElem, store, 0)
+		suite, err := NewTestSuite(testToolConfig, manifestPath, reportElem, store, idx)
 		if err != nil {
 			logrus.Error(err)
-			if reportFile != "" {
+			if reportFile != "" && parallelSuites <= 1 {
 				rep.WriteToFile(reportFile, reportFormat)
 			}
 			return false
 		}
 
+		if dryRun {
+			return suite.DryRun()
+		}
+
+		unlock := locks.lock(suite)
+		defer unlock()
+
 		return suite.Run()
 	}
 
 	// Decide if run only one test
+	manifests := []string{}
 	if len(singleTests) > 0 {
-		for _, singleTest := range singleTests {
-			absManifestPath, _ := filepath.Abs(singleTest)
-			c := rep.Root().NewChild(singleTest)
+		manifests = append(manifests, singleTests...)
+	} else {
+		for _, singlerootDirectory := range testToolConfig.TestDirectories {
+			manifests = append(manifests, filepath.Join(singlerootDirectory, "manifest.json"))
+		}
+	}
 
-			success := runSingleTest(absManifestPath, c)
-			c.Leave(success)
+	if rerunFailed != "" {
+		manifests, err = failedManifests(rerunFailed, manifests)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		logrus.Infof("Rerunning %d failed test suites", len(manifests))
+	}
 
-			if reportFile != "" {
-				rep.WriteToFile(reportFile, reportFormat)
-			}
+	// The watcher needs to know which files every suite loads, so suites run one after another
+	var watcher *suiteWatcher
+	if watch {
+		watcher = newSuiteWatcher()
+		parallelSuites = 1
+	}
 
-			if stopOnFail && !success {
-				break
-			}
-		}
-	} else {
-		for _, singlerootDirectory := range testToolConfig.TestDirectories {
-			manifestPath := filepath.Join(singlerootDirectory, "manifest.json")
+	runManifests := func(manifests []string) {
+		runSuites(manifests, parallelSuites, stopOnFail, func(idx int, manifestPath string) bool {
 			absManifestPath, _ := filepath.Abs(manifestPath)
 			c := rep.Root().NewChild(manifestPath)
 
-			success := runSingleTest(absManifestPath, c)
+			var success bool
+			if watcher != nil {
+				success = watcher.runSuite(manifestPath, func() bool {
+					return runSingleTest(absManifestPath, c, idx)
+				})
+			} else {
+				success = runSingleTest(absManifestPath, c, idx)
+			}
 			c.Leave(success)
 
-			if reportFile != "" {
+			// Suites running in parallel still write into the report, so it is only saved once all are done
+			if reportFile != "" && parallelSuites <= 1 {
 				rep.WriteToFile(reportFile, reportFormat)
 			}
 
-			if stopOnFail && !success {
-				break
-			}
+			return success
+		})
+
+		if reportFile != "" && parallelSuites > 1 {
+			rep.WriteToFile(reportFile, reportFormat)
+		}
+	}
+
+	runManifests(manifests)
+
+	if watcher != nil {
+		printSummary(rep)
+		err := watcher.watch(func(manifests []string) {
+			rep = report.NewReport()
+			runManifests(manifests)
+			printSummary(rep)
+		})
+		if err != nil {
+			logrus.Fatalf("Watching files failed: %s", err)
 		}
 	}
 
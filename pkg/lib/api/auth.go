@@ -0,0 +1,484 @@
+package api
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/programmfabrik/apitest/pkg/lib/util"
+)
+
+// RequestAuth signs the built request. Exactly one of the signers is set
+type RequestAuth struct {
+	AWSSigV4 *AWSSigV4Auth `yaml:"aws_sigv4" json:"aws_sigv4"`
+	HMAC     *HMACAuth     `yaml:"hmac" json:"hmac"`
+	JWT      *JWTAuth      `yaml:"jwt" json:"jwt"`
+}
+
+// signer adds the signature to the request. The body is only read for signers
+// that need it
+type signer interface {
+	needsBody() bool
+	sign(req *http.Request, body []byte, now time.Time) error
+}
+
+// now returns the time of the signature, replaced in tests
+var now = time.Now
+
+// signer returns the configured signer. Key files are relative to the manifestDir
+func (auth RequestAuth) signer(manifestDir string) (signer, error) {
+	signers := []signer{}
+	if auth.AWSSigV4 != nil {
+		signers = append(signers, auth.AWSSigV4)
+	}
+	if auth.HMAC != nil {
+		signers = append(signers, auth.HMAC)
+	}
+	if auth.JWT != nil {
+		jwt := *auth.JWT
+		jwt.manifestDir = manifestDir
+		signers = append(signers, &jwt)
+	}
+	if len(signers) != 1 {
+		return nil, fmt.Errorf("auth needs exactly one of aws_sigv4, hmac and jwt")
+	}
+	return signers[0], nil
+}
+
+// sign signs the request. Only if the signer hashes the payload, the body is read
+// and replaced by its bytes, so streamed bodies stay streamed otherwise
+func (auth RequestAuth) sign(req *http.Request, manifestDir string) error {
+	s, err := auth.signer(manifestDir)
+	if err != nil {
+		return err
+	}
+
+	var body []byte
+	if s.needsBody() && req.Body != nil && req.Body != http.NoBody {
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return fmt.Errorf("could not read body to sign: %s", err)
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	return s.sign(req, body, now().UTC())
+}
+
+// AWSSigV4Auth signs the request with AWS Signature Version 4, see
+// https://docs.aws.amazon.com/general/latest/gr/signature-version-4.html
+type AWSSigV4Auth struct {
+	Region          string `yaml:"region" json:"region"`
+	Service         string `yaml:"service" json:"service"`
+	AccessKeyID     string `yaml:"access_key_id" json:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key" json:"secret_access_key"`
+	SessionToken    string `yaml:"session_token" json:"session_token"`
+	UnsignedPayload bool   `yaml:"unsigned_payload" json:"unsigned_payload"` // do not read the body, for large uploads
+}
+
+func (a *AWSSigV4Auth) needsBody() bool {
+	return !a.UnsignedPayload
+}
+
+func (a *AWSSigV4Auth) sign(req *http.Request, body []byte, now time.Time) error {
+	if a.Region == "" || a.Service == "" || a.AccessKeyID == "" || a.SecretAccessKey == "" {
+		return fmt.Errorf("aws_sigv4 needs region, service, access_key_id and secret_access_key")
+	}
+
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := "UNSIGNED-PAYLOAD"
+	if !a.UnsignedPayload {
+		payloadHash = sha256Hex(body)
+	}
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if a.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", a.SessionToken)
+	}
+	if a.Service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	// Signed are the host, the content type and all x-amz-* headers
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name != "content-type" && !strings.HasPrefix(name, "x-amz-") {
+			continue
+		}
+		trimmed := make([]string, len(values))
+		for i, v := range values {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		headers[name] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	canonicalHeaders := ""
+	for _, name := range names {
+		canonicalHeaders += name + ":" + headers[name] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	uri := req.URL.EscapedPath()
+	if uri == "" {
+		uri = "/"
+	}
+	if a.Service != "s3" {
+		// Other services expect the path segments encoded twice
+		uri = awsEscape(uri, false)
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uri,
+		awsCanonicalQuery(req),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, a.Region, a.Service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := []byte("AWS4" + a.SecretAccessKey)
+	for _, part := range []string{date, a.Region, a.Service, "aws4_request"} {
+		key = hmacSum(sha256.New, key, []byte(part))
+	}
+	signature := hex.EncodeToString(hmacSum(sha256.New, key, []byte(stringToSign)))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		a.AccessKeyID, scope, signedHeaders, signature))
+	return nil
+}
+
+// awsCanonicalQuery returns the encoded query parameters sorted by key, then by
+// value. Sorting the joined "key=value" strings would be wrong for keys that are
+// prefixes of other keys, like "a" and "a-b"
+func awsCanonicalQuery(req *http.Request) string {
+	type param struct{ key, value string }
+	params := []param{}
+	for key, values := range req.URL.Query() {
+		for _, v := range values {
+			params = append(params, param{awsEscape(key, true), awsEscape(v, true)})
+		}
+	}
+	sort.Slice(params, func(i, j int) bool {
+		if params[i].key != params[j].key {
+			return params[i].key < params[j].key
+		}
+		return params[i].value < params[j].value
+	})
+	pairs := make([]string, len(params))
+	for i, p := range params {
+		pairs[i] = p.key + "=" + p.value
+	}
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape percent encodes all but the unreserved characters. The "/" is kept
+// in paths
+func awsEscape(s string, encodeSlash bool) string {
+	var buf strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			buf.WriteByte(c)
+		default:
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
+
+// HMACAuth signs a canonical string of the request with a shared secret
+type HMACAuth struct {
+	Secret    string `yaml:"secret" json:"secret"`
+	Algorithm string `yaml:"algorithm" json:"algorithm"` // "sha256" (default), "sha1" or "sha512"
+	Encoding  string `yaml:"encoding" json:"encoding"`   // "hex" (default) or "base64"
+	// Lines of the canonical string, joined by "\n". The placeholders {method},
+	// {path}, {query}, {timestamp}, {body_sha256} and {header:<name>} are replaced
+	Canonical []string `yaml:"canonical" json:"canonical"`
+	Header    string   `yaml:"header" json:"header"` // default "Authorization"
+	Format    string   `yaml:"format" json:"format"` // value of the header, "{signature}" is replaced
+	// If set, the timestamp in unix seconds is sent in this header
+	TimestampHeader string `yaml:"timestamp_header" json:"timestamp_header"`
+}
+
+var defaultHMACCanonical = []string{"{method}", "{path}", "{query}", "{timestamp}", "{body_sha256}"}
+
+func (h *HMACAuth) canonical() []string {
+	if len(h.Canonical) == 0 {
+		return defaultHMACCanonical
+	}
+	return h.Canonical
+}
+
+func (h *HMACAuth) needsBody() bool {
+	return strings.Contains(strings.Join(h.canonical(), "\n"), "{body_sha256}")
+}
+
+func (h *HMACAuth) sign(req *http.Request, body []byte, now time.Time) error {
+	if h.Secret == "" {
+		return fmt.Errorf("hmac needs a secret")
+	}
+	var hashFunc func() hash.Hash
+	switch h.Algorithm {
+	case "", "sha256":
+		hashFunc = sha256.New
+	case "sha1":
+		hashFunc = sha1.New
+	case "sha512":
+		hashFunc = sha512.New
+	default:
+		return fmt.Errorf("unknown hmac algorithm '%s'", h.Algorithm)
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	if h.TimestampHeader != "" {
+		req.Header.Set(h.TimestampHeader, timestamp)
+	}
+
+	lines := make([]string, len(h.canonical()))
+	for i, line := range h.canonical() {
+		line = strings.NewReplacer(
+			"{method}", req.Method,
+			"{path}", req.URL.EscapedPath(),
+			"{query}", req.URL.RawQuery,
+			"{timestamp}", timestamp,
+			"{body_sha256}", sha256Hex(body),
+		).Replace(line)
+		// Replace {header:<name>} with the value of the header
+		for {
+			start := strings.Index(line, "{header:")
+			if start < 0 {
+				break
+			}
+			end := strings.Index(line[start:], "}")
+			if end < 0 {
+				return fmt.Errorf("unclosed placeholder in hmac canonical line '%s'", h.canonical()[i])
+			}
+			end += start
+			line = line[:start] + req.Header.Get(line[start+len("{header:"):end]) + line[end+1:]
+		}
+		lines[i] = line
+	}
+
+	sum := hmacSum(hashFunc, []byte(h.Secret), []byte(strings.Join(lines, "\n")))
+	var signature string
+	switch h.Encoding {
+	case "", "hex":
+		signature = hex.EncodeToString(sum)
+	case "base64":
+		signature = base64.StdEncoding.EncodeToString(sum)
+	default:
+		return fmt.Errorf("unknown hmac encoding '%s'", h.Encoding)
+	}
+
+	header := h.Header
+	if header == "" {
+		header = "Authorization"
+	}
+	format := h.Format
+	if format == "" {
+		format = "{signature}"
+	}
+	req.Header.Set(header, strings.Replace(format, "{signature}", signature, -1))
+	return nil
+}
+
+// JWTAuth sends a json web token, minted for every request, as bearer token
+type JWTAuth struct {
+	Algorithm string                 `yaml:"algorithm" json:"algorithm"` // HS256 (default), HS384, HS512, RS256, RS384, RS512 or ES256
+	Secret    string                 `yaml:"secret" json:"secret"`       // for HS*
+	Key       string                 `yaml:"key" json:"key"`             // path spec of a PEM private key, for RS* and ES256
+	KeyID     string                 `yaml:"kid" json:"kid"`
+	Claims    map[string]interface{} `yaml:"claims" json:"claims"`
+	ExpiresIn int                    `yaml:"expires_in_s" json:"expires_in_s"` // sets "exp", if > 0
+
+	manifestDir string
+}
+
+func (j *JWTAuth) needsBody() bool {
+	return false
+}
+
+func (j *JWTAuth) sign(req *http.Request, body []byte, now time.Time) error {
+	token, err := j.token(now)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// token returns the signed token. "iat" is set, unless it is in the claims
+func (j *JWTAuth) token(now time.Time) (string, error) {
+	alg := j.Algorithm
+	if alg == "" {
+		alg = "HS256"
+	}
+
+	header := map[string]interface{}{"alg": alg, "typ": "JWT"}
+	if j.KeyID != "" {
+		header["kid"] = j.KeyID
+	}
+	claims := map[string]interface{}{"iat": now.Unix()}
+	if j.ExpiresIn > 0 {
+		claims["exp"] = now.Unix() + int64(j.ExpiresIn)
+	}
+	for k, v := range j.Claims {
+		claims[k] = v
+	}
+
+	headerBytes, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsBytes, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("could not marshal jwt claims: %s", err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(headerBytes) + "." + base64.RawURLEncoding.EncodeToString(claimsBytes)
+
+	var signature []byte
+	switch alg {
+	case "HS256", "HS384", "HS512":
+		if j.Secret == "" {
+			return "", fmt.Errorf("jwt %s needs a secret", alg)
+		}
+		hashFunc := map[string]func() hash.Hash{"HS256": sha256.New, "HS384": sha512.New384, "HS512": sha512.New}[alg]
+		signature = hmacSum(hashFunc, []byte(j.Secret), []byte(signingInput))
+	case "RS256", "RS384", "RS512", "ES256":
+		key, err := j.privateKey()
+		if err != nil {
+			return "", err
+		}
+		signature, err = signJWT(alg, key, []byte(signingInput))
+		if err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unknown jwt algorithm '%s'", alg)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// privateKey loads the PEM key, in PKCS #1, PKCS #8 or SEC 1 format
+func (j *JWTAuth) privateKey() (crypto.Signer, error) {
+	if j.Key == "" {
+		return nil, fmt.Errorf("jwt %s needs a key", j.Algorithm)
+	}
+	_, file, err := util.OpenFileOrUrl(j.Key, j.manifestDir)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	pemBytes, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in jwt key '%s'", j.Key)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse jwt key '%s': %s", j.Key, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported type of jwt key '%s'", j.Key)
+	}
+	return signer, nil
+}
+
+// signJWT signs the input with the RSA or ECDSA key. ECDSA signatures are the
+// concatenated r and s, as JWS expects
+func signJWT(alg string, key crypto.Signer, input []byte) ([]byte, error) {
+	hashes := map[string]crypto.Hash{"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512, "ES256": crypto.SHA256}
+	h := hashes[alg].New()
+	h.Write(input)
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return nil, fmt.Errorf("jwt %s needs an ecdsa key", alg)
+		}
+		return rsa.SignPKCS1v15(rand.Reader, k, hashes[alg], digest)
+	case *ecdsa.PrivateKey:
+		if alg != "ES256" {
+			return nil, fmt.Errorf("jwt %s needs a rsa key", alg)
+		}
+		if k.Curve.Params().BitSize != 256 {
+			return nil, fmt.Errorf("jwt ES256 needs a P-256 key")
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest)
+		if err != nil {
+			return nil, err
+		}
+		signature := make([]byte, 64)
+		rBytes, sBytes := r.Bytes(), s.Bytes()
+		copy(signature[32-len(rBytes):32], rBytes)
+		copy(signature[64-len(sBytes):], sBytes)
+		return signature, nil
+	default:
+		return nil, fmt.Errorf("unsupported jwt key type %T", key)
+	}
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSum(hashFunc func() hash.Hash, key, data []byte) []byte {
+	mac := hmac.New(hashFunc, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
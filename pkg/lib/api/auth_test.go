@@ -0,0 +1,190 @@
+package api
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/programmfabrik/apitest/pkg/lib/filesystem"
+	go_test_utils "github.com/programmfabrik/go-test-utils"
+	"github.com/spf13/afero"
+)
+
+func TestAWSSigV4(t *testing.T) {
+	// Test vectors of the AWS Signature Version 4 test suite
+	auth := RequestAuth{AWSSigV4: &AWSSigV4Auth{
+		Region:          "us-east-1",
+		Service:         "service",
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}}
+	now = func() time.Time { return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	tests := []struct {
+		url       string
+		signature string
+	}{
+		{"https://example.amazonaws.com/", "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{"https://example.amazonaws.com/?Param2=value2&Param1=value1", "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"},
+		// "a" is a prefix of "a-b", so it is sorted first, although "-" < "="
+		{"https://example.amazonaws.com/?a-b=2&a=1", "321dff75bd2a219c1b95fc5dbc497343614dbe8f73319c9d9c415bca43078ce2"},
+	}
+	for _, tc := range tests {
+		req, _ := http.NewRequest("GET", tc.url, nil)
+		err := auth.sign(req, "")
+		go_test_utils.ExpectNoError(t, err, "error signing request")
+		go_test_utils.AssertStringEquals(t,
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature="+tc.signature,
+			req.Header.Get("Authorization"))
+		go_test_utils.AssertStringEquals(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	}
+}
+
+func TestSignedRequests(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecBytes, _ := x509.MarshalECPrivateKey(ecKey)
+	filesystem.Fs = afero.NewMemMapFs()
+	afero.WriteFile(filesystem.Fs, "test/rsa.pem", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}), 0644)
+	afero.WriteFile(filesystem.Fs, "test/ec.pem", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecBytes}), 0644)
+
+	// The server verifies the signatures and answers with the jwt claims
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		if sig := r.Header.Get("X-Signature"); sig != "" {
+			bodySum := sha256.Sum256(body)
+			canonical := strings.Join([]string{r.Method, r.URL.Path, r.Header.Get("X-Timestamp"), hex.EncodeToString(bodySum[:])}, "\n")
+			mac := hmac.New(sha256.New, []byte("secret"))
+			mac.Write([]byte(canonical))
+			if sig != "HMAC "+base64.StdEncoding.EncodeToString(mac.Sum(nil)) {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+			return
+		}
+
+		parts := strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), ".")
+		if len(parts) != 3 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		headerBytes, _ := base64.RawURLEncoding.DecodeString(parts[0])
+		header := map[string]interface{}{}
+		json.Unmarshal(headerBytes, &header)
+
+		valid := false
+		switch header["alg"] {
+		case "HS256":
+			mac := hmac.New(sha256.New, []byte("secret"))
+			mac.Write([]byte(parts[0] + "." + parts[1]))
+			valid = hmac.Equal(signature, mac.Sum(nil))
+		case "RS256":
+			valid = rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA256, digest[:], signature) == nil
+		case "ES256":
+			valid = len(signature) == 64 && ecdsa.Verify(&ecKey.PublicKey, digest[:],
+				new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:]))
+		}
+		if !valid {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		w.Write(claims)
+	}))
+	defer ts.Close()
+
+	hmacAuth := &RequestAuth{HMAC: &HMACAuth{
+		Secret:          "secret",
+		Encoding:        "base64",
+		Canonical:       []string{"{method}", "{path}", "{header:X-Timestamp}", "{body_sha256}"},
+		Header:          "X-Signature",
+		Format:          "HMAC {signature}",
+		TimestampHeader: "X-Timestamp",
+	}}
+	tests := []struct {
+		auth *RequestAuth
+		body string
+	}{
+		{hmacAuth, ""},
+		{&RequestAuth{JWT: &JWTAuth{Secret: "secret", Claims: map[string]interface{}{"sub": "apitest"}}}, `"sub":"apitest"`},
+		{&RequestAuth{JWT: &JWTAuth{Algorithm: "RS256", Key: "@rsa.pem", ExpiresIn: 60}}, `"exp":`},
+		{&RequestAuth{JWT: &JWTAuth{Algorithm: "ES256", Key: "@ec.pem", KeyID: "1"}}, `"iat":`},
+	}
+	for _, tc := range tests {
+		request := Request{
+			ServerURL:   ts.URL,
+			Endpoint:    "signed",
+			Method:      "POST",
+			Body:        map[string]interface{}{"a": 1.0},
+			ManifestDir: "test/",
+			Auth:        tc.auth,
+		}
+		response, err := request.Send()
+		go_test_utils.ExpectNoError(t, err, "error sending signed request")
+		go_test_utils.AssertIntEquals(t, http.StatusOK, response.StatusCode())
+		if !strings.Contains(string(response.Body()), tc.body) {
+			t.Errorf("expected %s in %s", tc.body, response.Body())
+		}
+	}
+
+	request := Request{ServerURL: ts.URL, Auth: &RequestAuth{HMAC: hmacAuth.HMAC, JWT: &JWTAuth{Secret: "secret"}}}
+	_, err := request.Send()
+	go_test_utils.ExpectError(t, err, "expected error for two signers")
+}
+
+func TestSignBody(t *testing.T) {
+	aws := &AWSSigV4Auth{Region: "us-east-1", Service: "s3", AccessKeyID: "id", SecretAccessKey: "secret"}
+	unsigned := *aws
+	unsigned.UnsignedPayload = true
+
+	tests := []struct {
+		auth     RequestAuth
+		readBody bool
+	}{
+		{RequestAuth{AWSSigV4: aws}, true},
+		{RequestAuth{AWSSigV4: &unsigned}, false},
+		{RequestAuth{JWT: &JWTAuth{Secret: "secret"}}, false},
+	}
+	for _, tc := range tests {
+		body := streamBody{ioutil.NopCloser(strings.NewReader("payload")), 7}
+		req, _ := http.NewRequest("PUT", "https://bucket.s3.amazonaws.com/key", body)
+		err := tc.auth.sign(req, "")
+		go_test_utils.ExpectNoError(t, err, "error signing request")
+
+		_, streamed := req.Body.(streamBody)
+		if streamed == tc.readBody {
+			t.Errorf("expected body to be read: %t, got streamed body: %t", tc.readBody, streamed)
+		}
+		if tc.readBody {
+			getBody, err := req.GetBody()
+			go_test_utils.ExpectNoError(t, err, "error getting body")
+			content, _ := ioutil.ReadAll(getBody)
+			go_test_utils.AssertStringEquals(t, "payload", string(content))
+		}
+	}
+
+	// Logging the request does not sign it
+	request := Request{ServerURL: "https://example.com", Auth: &RequestAuth{JWT: &JWTAuth{Secret: "secret"}}}
+	if strings.Contains(request.ToString(true), "Bearer") {
+		t.Errorf("expected unsigned request in log: %s", request.ToString(true))
+	}
+}
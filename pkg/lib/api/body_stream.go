@@ -0,0 +1,115 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/programmfabrik/apitest/pkg/lib/filesystem"
+	"github.com/programmfabrik/apitest/pkg/lib/util"
+)
+
+// generatePrefix marks a path spec of a generated payload, like "@generate:500MB"
+const generatePrefix = "generate:"
+
+// streamBody is a request body that is read while it is sent. The size is
+// sent as Content-Length, a negative size is unknown and sent chunked
+type streamBody struct {
+	io.ReadCloser
+	size int64
+}
+
+// openBodyFile opens the file of the path spec to be sent. The size is -1 for
+// remote files
+func openBodyFile(pathSpec, manifestDir string) (streamBody, error) {
+	path := strings.TrimPrefix(pathSpec, "@")
+	if strings.HasPrefix(path, generatePrefix) {
+		size, err := parseSize(path[len(generatePrefix):])
+		if err != nil {
+			return streamBody{}, fmt.Errorf("invalid size in '%s': %s", pathSpec, err)
+		}
+		return streamBody{ioutil.NopCloser(io.LimitReader(zeroReader{}, size)), size}, nil
+	}
+
+	path, file, err := util.OpenFileOrUrl(pathSpec, manifestDir)
+	if err != nil {
+		return streamBody{}, err
+	}
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return streamBody{file, -1}, nil
+	}
+	info, err := filesystem.Fs.Stat(util.LocalPath(path, manifestDir))
+	if err != nil {
+		file.Close()
+		return streamBody{}, err
+	}
+	return streamBody{file, info.Size()}, nil
+}
+
+// parseSize parses sizes like "512", "10KB", "500MB" or "2GB". Units are
+// powers of 1024
+func parseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		factor int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	}
+	factor := int64(1)
+	s = strings.ToUpper(strings.TrimSpace(s))
+	for _, unit := range units {
+		if strings.HasSuffix(s, unit.suffix) {
+			factor = unit.factor
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("size must not be negative")
+	}
+	return n * factor, nil
+}
+
+// zeroReader reads zero bytes endlessly
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// countingWriter counts the bytes written to it
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// curlDataFile returns the curl argument to send the file of the path spec
+func curlDataFile(pathSpec, manifestDir string) string {
+	path := strings.TrimPrefix(pathSpec, "@")
+	if strings.HasPrefix(path, generatePrefix) {
+		size, err := parseSize(path[len(generatePrefix):])
+		if err == nil {
+			return fmt.Sprintf("@<(head -c %d /dev/zero)", size)
+		}
+	}
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return shellQuote("@" + path)
+	}
+	return shellQuote("@" + util.LocalPath(path, manifestDir))
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/programmfabrik/apitest/pkg/lib/filesystem"
+	go_test_utils "github.com/programmfabrik/go-test-utils"
+	"github.com/spf13/afero"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		size int64
+	}{
+		{"512", 512},
+		{"10B", 10},
+		{"10KB", 10 << 10},
+		{"500MB", 500 << 20},
+		{"2gb", 2 << 30},
+	}
+	for _, tc := range tests {
+		size, err := parseSize(tc.in)
+		go_test_utils.ExpectNoError(t, err, tc.in)
+		if size != tc.size {
+			t.Errorf("%s: expected %d, got %d", tc.in, tc.size, size)
+		}
+	}
+
+	for _, in := range []string{"", "MB", "1TB", "-1KB"} {
+		_, err := parseSize(in)
+		go_test_utils.ExpectError(t, err, "expected error for size "+in)
+	}
+}
+
+func TestStreamedBodies(t *testing.T) {
+	filesystem.Fs = afero.NewMemMapFs()
+	afero.WriteFile(filesystem.Fs, "test/a.txt", []byte("file a"), 0644)
+
+	tests := []struct {
+		request Request
+		size    int64
+	}{
+		{Request{BodyType: "file", BodyFile: "@a.txt"}, 6},
+		{Request{BodyType: "file", BodyFile: "@generate:1MB"}, 1 << 20},
+		{Request{BodyType: "multipart", Body: map[string]interface{}{
+			"a":    "@a.txt",
+			"big":  "@generate:2MB",
+			"name": "apitest",
+		}}, -1},
+	}
+
+	for _, tc := range tests {
+		tc.request.ManifestDir = "test/"
+		tc.request.Method = "POST"
+
+		httpRequest, err := tc.request.buildHttpRequest()
+		go_test_utils.ExpectNoError(t, err, "error building request")
+		body, err := ioutil.ReadAll(httpRequest.Body)
+		go_test_utils.ExpectNoError(t, err, "error reading body")
+
+		// The computed Content-Length must match the streamed body
+		if httpRequest.ContentLength != int64(len(body)) {
+			t.Errorf("%s: Content-Length %d, but body has %d bytes", tc.request.BodyType, httpRequest.ContentLength, len(body))
+		}
+		if tc.size >= 0 && int64(len(body)) != tc.size {
+			t.Errorf("%s: expected %d bytes, got %d", tc.request.BodyType, tc.size, len(body))
+		}
+		if tc.request.BodyType == "multipart" && !strings.Contains(string(body), "file a") {
+			t.Errorf("file a missing in multipart body")
+		}
+
+		tc.request.Chunked = true
+		httpRequest, err = tc.request.buildHttpRequest()
+		go_test_utils.ExpectNoError(t, err, "error building request")
+		httpRequest.Body.Close()
+		if httpRequest.ContentLength != -1 {
+			t.Errorf("%s: expected chunked request, got Content-Length %d", tc.request.BodyType, httpRequest.ContentLength)
+		}
+	}
+
+	request := Request{BodyType: "file", BodyFile: "@generate:1KB", ManifestDir: "test/"}
+	curl := request.ToString(true)
+	if !strings.Contains(curl, "--data-binary @<(head -c 1024 /dev/zero)") {
+		t.Errorf("expected generated payload in curl: %s", curl)
+	}
+}
+
+// closeNotifyFile reports when it is closed
+type closeNotifyFile struct {
+	afero.File
+	closed chan string
+}
+
+func (f closeNotifyFile) Close() error {
+	f.closed <- f.Name()
+	return f.File.Close()
+}
+
+func TestBuildErrorClosesBody(t *testing.T) {
+	memFs := afero.NewMemMapFs()
+	afero.WriteFile(memFs, "test/a.txt", []byte("file a"), 0644)
+	closed := make(chan string, 10)
+	testFs := filesystem.NewTestFs(memFs)
+	testFs.MockOpen = func(name string) (afero.File, error) {
+		file, err := memFs.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		return closeNotifyFile{file, closed}, nil
+	}
+	filesystem.Fs = testFs
+
+	requests := []Request{
+		{BodyType: "file", BodyFile: "@a.txt"},
+		{BodyType: "multipart", Body: map[string]interface{}{"a": "@a.txt"}},
+	}
+	for _, request := range requests {
+		request.ManifestDir = "test/"
+		request.Method = "POST"
+		// Fails after the body was built, as there is no datastore
+		request.HeaderFromStore = map[string]string{"X-Value": "value"}
+
+		_, err := request.buildHttpRequest()
+		go_test_utils.ExpectError(t, err, "expected error for header_from_store without datastore")
+		select {
+		case <-closed:
+		case <-time.After(time.Second):
+			t.Errorf("%s: body file was not closed", request.BodyType)
+		}
+	}
+}
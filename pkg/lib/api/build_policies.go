@@ -2,87 +2,325 @@ package api
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"mime/multipart"
+	"net/textproto"
 	"net/url"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/clbanning/mxj"
 	"github.com/pkg/errors"
 	"github.com/programmfabrik/apitest/pkg/lib/util"
 )
 
-func buildMultipart(request Request) (additionalHeaders map[string]string, body io.Reader, err error) {
-	additionalHeaders = make(map[string]string, 0)
+// MultipartPart is a part of a multipart body, given as object in the body. Exactly
+// one of Value, JSON and File is used
+type MultipartPart struct {
+	Value       *string           `json:"value"`
+	JSON        interface{}       `json:"json"`
+	File        string            `json:"file"` // path spec
+	Filename    string            `json:"filename"`
+	ContentType string            `json:"content_type"`
+	Header      map[string]string `json:"header"`
+}
 
-	var buf = bytes.NewBuffer([]byte{})
-	w := multipart.NewWriter(buf)
+// multipartField is a part with the field name it is sent with
+type multipartField struct {
+	name string
+	part MultipartPart
+}
 
-	var replaceFilename *string
-	val, ok := request.Body.(map[string]interface{})["file:filename"]
+// multipartFields returns the parts of the multipart body, sorted by field name.
+// A field can be a path spec of a file, a plain value, a part object or an array
+// of those for multiple parts with the same name
+func multipartFields(request Request) ([]multipartField, error) {
+	bodyMap, ok := request.Body.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("multipart body should be an object")
+	}
+
+	// "file:filename" replaces the filename of all files without their own filename
+	var replaceFilename string
+	val, ok := bodyMap["file:filename"]
 	if ok {
 		f, ok := val.(util.JsonString)
 		if !ok {
-			return additionalHeaders, body, fmt.Errorf("file:filename should be a string")
+			return nil, fmt.Errorf("file:filename should be a string")
 		}
-		replaceFilename = &f
+		replaceFilename = f
 	}
 
-	additionalHeaders["Content-Type"] = w.FormDataContentType()
-	for key, val := range request.Body.(map[string]interface{}) {
-
+	names := make([]string, 0, len(bodyMap))
+	for key := range bodyMap {
 		if key == "file:filename" {
 			continue
 		}
+		names = append(names, key)
+	}
+	sort.Strings(names)
 
-		pathSpec, ok := val.(util.JsonString)
+	fields := []multipartField{}
+	for _, name := range names {
+		values, ok := bodyMap[name].([]interface{})
 		if !ok {
-			return additionalHeaders, body, fmt.Errorf("pathSpec should be a string")
+			values = []interface{}{bodyMap[name]}
+		}
+		for _, val := range values {
+			part, err := multipartPart(val)
+			if err != nil {
+				return nil, fmt.Errorf("invalid multipart field '%s': %s", name, err)
+			}
+			if part.File != "" && part.Filename == "" {
+				part.Filename = part.File[1:]
+				if replaceFilename != "" {
+					part.Filename = replaceFilename
+				}
+			}
+			fields = append(fields, multipartField{name: name, part: part})
+		}
+	}
+	return fields, nil
+}
+
+func multipartPart(val interface{}) (part MultipartPart, err error) {
+	switch v := val.(type) {
+	case util.JsonString:
+		if util.IsPathSpec([]byte(v)) {
+			part.File = v
+		} else {
+			part.Value = &v
+		}
+	case map[string]interface{}:
+		if file, ok := v["file"]; ok {
+			if _, ok := file.(util.JsonString); !ok {
+				return part, fmt.Errorf("pathSpec should be a string")
+			}
+		}
+		partBytes, err := json.Marshal(v)
+		if err != nil {
+			return part, err
+		}
+		err = json.Unmarshal(partBytes, &part)
+		if err != nil {
+			return part, err
+		}
+		set := 0
+		if part.Value != nil {
+			set++
+		}
+		if part.JSON != nil {
+			set++
+		}
+		if part.File != "" {
+			set++
+			if !util.IsPathSpec([]byte(part.File)) {
+				return part, fmt.Errorf("pathSpec %s is not valid", part.File)
+			}
+		}
+		if set != 1 {
+			return part, fmt.Errorf("part needs exactly one of value, json and file")
+		}
+	case nil:
+		return part, fmt.Errorf("value is null")
+	default:
+		// numbers and booleans are sent as text
+		str := fmt.Sprintf("%v", v)
+		part.Value = &str
+	}
+	return part, nil
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// mimeHeader returns the headers of the part, with defaults for the content type
+func (field multipartField) mimeHeader() textproto.MIMEHeader {
+	part := field.part
+	h := textproto.MIMEHeader{}
+
+	disposition := fmt.Sprintf(`form-data; name="%s"`, quoteEscaper.Replace(field.name))
+	contentType := part.ContentType
+	switch {
+	case part.File != "":
+		disposition += fmt.Sprintf(`; filename="%s"`, quoteEscaper.Replace(part.Filename))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+	case part.JSON != nil:
+		if contentType == "" {
+			contentType = "application/json"
+		}
+	}
+	h.Set("Content-Disposition", disposition)
+	if contentType != "" {
+		h.Set("Content-Type", contentType)
+	}
+	for k, v := range part.Header {
+		h.Set(k, v)
+	}
+	return h
+}
+
+// curlArg returns the curl option that sends the part
+func (field multipartField) curlArg(manifestDir string) string {
+	part := field.part
+	if part.Value != nil && part.ContentType == "" && len(part.Header) == 0 {
+		return "--form-string " + shellQuote(field.name+"="+*part.Value)
+	}
+
+	var arg string
+	switch {
+	case part.Value != nil:
+		arg = fmt.Sprintf(`%s="%s"`, field.name, quoteEscaper.Replace(*part.Value))
+	case part.JSON != nil:
+		jsonBytes, _ := json.Marshal(part.JSON)
+		arg = fmt.Sprintf(`%s="%s"`, field.name, quoteEscaper.Replace(string(jsonBytes)))
+		if part.ContentType == "" {
+			arg += ";type=application/json"
 		}
-		if !util.IsPathSpec([]byte(pathSpec)) {
-			return additionalHeaders, body, fmt.Errorf("pathSpec %s is not valid", pathSpec)
+	default:
+		arg = fmt.Sprintf("%s=@%s", field.name, path.Join(manifestDir, part.File[1:]))
+		if part.Filename != part.File[1:] {
+			arg += fmt.Sprintf(`;filename="%s"`, quoteEscaper.Replace(part.Filename))
 		}
+	}
+	if part.ContentType != "" {
+		arg += ";type=" + part.ContentType
+	}
+	headerNames := make([]string, 0, len(part.Header))
+	for k := range part.Header {
+		headerNames = append(headerNames, k)
+	}
+	sort.Strings(headerNames)
+	for _, k := range headerNames {
+		arg += fmt.Sprintf(`;headers="%s: %s"`, k, quoteEscaper.Replace(part.Header[k]))
+	}
+	return "-F " + shellQuote(arg)
+}
+
+// shellQuote quotes the string for the shell, like the curl command does
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// buildMultipart streams the multipart body, so large files are not held in
+// memory. Files are opened first, so missing files are reported right away
+func buildMultipart(request Request) (additionalHeaders map[string]string, body io.Reader, err error) {
+	additionalHeaders = make(map[string]string, 0)
 
-		var err error
+	fields, err := multipartFields(request)
+	if err != nil {
+		return additionalHeaders, body, err
+	}
 
-		_, file, err := util.OpenFileOrUrl(pathSpec, request.ManifestDir)
+	files := make([]streamBody, len(fields))
+	closeFiles := func() {
+		for _, file := range files {
+			if file.ReadCloser != nil {
+				file.Close()
+			}
+		}
+	}
+	for i, field := range fields {
+		if field.part.File == "" {
+			continue
+		}
+		files[i], err = openBodyFile(field.part.File, request.ManifestDir)
 		if err != nil {
+			closeFiles()
 			return additionalHeaders, nil, err
 		}
-		defer file.Close()
+	}
 
-		var part io.Writer
-		if replaceFilename == nil {
-			part, err = w.CreateFormFile(key, pathSpec[1:])
+	// The size is the multipart body without the file contents, plus the file sizes
+	counter := &countingWriter{}
+	cw := multipart.NewWriter(counter)
+	size := int64(0)
+	err = writeMultipart(cw, fields, func(i int, w io.Writer) error {
+		if files[i].size < 0 || size < 0 {
+			size = -1
 		} else {
-			part, err = w.CreateFormFile(key, *replaceFilename)
+			size += files[i].size
 		}
+		return nil
+	})
+	if err != nil {
+		closeFiles()
+		return additionalHeaders, nil, err
+	}
+	if size >= 0 {
+		size += counter.n
+	}
+
+	pr, pw := io.Pipe()
+	w := multipart.NewWriter(pw)
+	err = w.SetBoundary(cw.Boundary())
+	if err != nil {
+		closeFiles()
+		return additionalHeaders, nil, err
+	}
+	additionalHeaders["Content-Type"] = w.FormDataContentType()
+
+	go func() {
+		defer closeFiles()
+		err := writeMultipart(w, fields, func(i int, partWriter io.Writer) error {
+			_, err := io.Copy(partWriter, files[i])
+			return err
+		})
+		pw.CloseWithError(err)
+	}()
+
+	return additionalHeaders, streamBody{pr, size}, nil
+}
+
+// writeMultipart writes all parts and closes the writer. The contents of
+// file parts are written by writeFile, with the index of the field
+func writeMultipart(w *multipart.Writer, fields []multipartField, writeFile func(int, io.Writer) error) error {
+	for i, field := range fields {
+		partWriter, err := w.CreatePart(field.mimeHeader())
 		if err != nil {
-			return additionalHeaders, nil, err
+			return err
 		}
-		if _, err := io.Copy(part, file); err != nil {
-			return additionalHeaders, nil, err
+
+		part := field.part
+		switch {
+		case part.Value != nil:
+			_, err = io.WriteString(partWriter, *part.Value)
+		case part.JSON != nil:
+			var jsonBytes []byte
+			jsonBytes, err = json.Marshal(part.JSON)
+			if err == nil {
+				_, err = partWriter.Write(jsonBytes)
+			}
+		default:
+			err = writeFile(i, partWriter)
+		}
+		if err != nil {
+			return err
 		}
 	}
-	err = w.Close()
-	body = bytes.NewBuffer(buf.Bytes())
-
-	return
+	return w.Close()
 }
 
 func buildUrlencoded(request Request) (additionalHeaders map[string]string, body io.Reader, err error) {
 	additionalHeaders = make(map[string]string, 0)
 	additionalHeaders["Content-Type"] = "application/x-www-form-urlencoded"
+	bodyMap, ok := request.Body.(map[string]interface{})
+	if !ok {
+		return additionalHeaders, body, fmt.Errorf("urlencoded body should be an object")
+	}
 	formParams := url.Values{}
-	for key, value := range request.Body.(map[string]interface{}) {
-		switch v := value.(type) {
-		case string:
-			formParams.Set(key, v)
-		case []string:
-			formParams[key] = v
-		default:
-			formParams.Set(key, fmt.Sprintf("%s", v))
+	for key, value := range bodyMap {
+		err = addFormValue(formParams, key, value)
+		if err != nil {
+			return additionalHeaders, body, err
 		}
 	}
 	body = strings.NewReader(formParams.Encode())
@@ -90,6 +328,51 @@ func buildUrlencoded(request Request) (additionalHeaders map[string]string, body
 
 }
 
+// addFormValue adds the value to the form. Arrays of plain values repeat the key,
+// objects and other arrays add their values with the key or index in brackets,
+// like "user[name]" or "items[0][id]"
+func addFormValue(formParams url.Values, key string, value interface{}) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			err := addFormValue(formParams, fmt.Sprintf("%s[%s]", key, k), val)
+			if err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for idx, val := range v {
+			switch val.(type) {
+			case map[string]interface{}, []interface{}:
+				err := addFormValue(formParams, fmt.Sprintf("%s[%d]", key, idx), val)
+				if err != nil {
+					return err
+				}
+			default:
+				err := addFormValue(formParams, key, val)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	case []string:
+		formParams[key] = append(formParams[key], v...)
+	case string:
+		formParams.Add(key, v)
+	case float64:
+		formParams.Add(key, strconv.FormatFloat(v, 'f', -1, 64))
+	case json.Number:
+		formParams.Add(key, v.String())
+	case bool:
+		formParams.Add(key, strconv.FormatBool(v))
+	case nil:
+		formParams.Add(key, "")
+	default:
+		return fmt.Errorf("urlencoded value of '%s' has unsupported type %T", key, v)
+	}
+	return nil
+}
+
 func buildRegular(request Request) (additionalHeaders map[string]string, body io.Reader, err error) {
 	additionalHeaders = make(map[string]string, 0)
 	additionalHeaders["Content-Type"] = "application/json"
@@ -106,6 +389,126 @@ func buildRegular(request Request) (additionalHeaders map[string]string, body io
 	return additionalHeaders, body, nil
 }
 
+// buildGraphQL sends the query, variables and operationName of the body as json.
+// The query can be a path spec of a .graphql file
+func buildGraphQL(request Request) (additionalHeaders map[string]string, body io.Reader, err error) {
+	additionalHeaders = make(map[string]string, 0)
+	additionalHeaders["Content-Type"] = "application/json"
+
+	bodyMap, ok := request.Body.(map[string]interface{})
+	if !ok {
+		return additionalHeaders, body, fmt.Errorf("graphql body should be an object with query and variables")
+	}
+	query, ok := bodyMap["query"].(util.JsonString)
+	if !ok {
+		return additionalHeaders, body, fmt.Errorf("graphql query should be a string")
+	}
+	if util.IsPathSpec([]byte(query)) {
+		_, file, err := util.OpenFileOrUrl(query, request.ManifestDir)
+		if err != nil {
+			return additionalHeaders, nil, err
+		}
+		defer file.Close()
+
+		queryBytes, err := ioutil.ReadAll(file)
+		if err != nil {
+			return additionalHeaders, nil, err
+		}
+		query = string(queryBytes)
+	}
+
+	gqlBody := map[string]interface{}{
+		"query": query,
+	}
+	if variables, ok := bodyMap["variables"]; ok {
+		gqlBody["variables"] = variables
+	}
+	if operationName, ok := bodyMap["operationName"]; ok {
+		gqlBody["operationName"] = operationName
+	}
+
+	bodyBytes, err := json.Marshal(gqlBody)
+	if err != nil {
+		return additionalHeaders, body, fmt.Errorf("error marshaling graphql body: %s", err)
+	}
+	return additionalHeaders, bytes.NewBuffer(bodyBytes), nil
+}
+
+// buildXML sends the body as xml. The body is an object with the root element, or a
+// path spec of a xml file. Keys starting with "-" are attributes, "#text" is the
+// text of an element with attributes
+func buildXML(request Request) (additionalHeaders map[string]string, body io.Reader, err error) {
+	additionalHeaders = make(map[string]string, 0)
+	additionalHeaders["Content-Type"] = "application/xml"
+
+	if pathSpec, ok := request.Body.(util.JsonString); ok && util.IsPathSpec([]byte(pathSpec)) {
+		file, err := openBodyFile(pathSpec, request.ManifestDir)
+		return additionalHeaders, file, err
+	}
+	bodyMap, ok := request.Body.(map[string]interface{})
+	if !ok || len(bodyMap) != 1 {
+		return additionalHeaders, body, fmt.Errorf("xml body should be an object with one root element, or a path spec")
+	}
+	xmlBytes, err := mxj.Map(bodyMap).Xml()
+	if err != nil {
+		return additionalHeaders, body, fmt.Errorf("error marshaling xml body: %s", err)
+	}
+	return additionalHeaders, strings.NewReader(xml.Header + string(xmlBytes)), nil
+}
+
+// buildText sends the body string, or the file of a path spec, as plain text
+func buildText(request Request) (additionalHeaders map[string]string, body io.Reader, err error) {
+	additionalHeaders = make(map[string]string, 0)
+	additionalHeaders["Content-Type"] = "text/plain; charset=utf-8"
+
+	text, ok := request.Body.(util.JsonString)
+	if !ok {
+		return additionalHeaders, body, fmt.Errorf("text body should be a string")
+	}
+	if util.IsPathSpec([]byte(text)) {
+		file, err := openBodyFile(text, request.ManifestDir)
+		return additionalHeaders, file, err
+	}
+	return additionalHeaders, strings.NewReader(text), nil
+}
+
+// buildRaw sends the bytes of the base64 encoded body
+func buildRaw(request Request) (additionalHeaders map[string]string, body io.Reader, err error) {
+	additionalHeaders = make(map[string]string, 0)
+	additionalHeaders["Content-Type"] = "application/octet-stream"
+
+	encoded, ok := request.Body.(util.JsonString)
+	if !ok {
+		return additionalHeaders, body, fmt.Errorf("raw body should be a base64 encoded string")
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return additionalHeaders, body, fmt.Errorf("error decoding raw body: %s", err)
+	}
+	return additionalHeaders, bytes.NewReader(raw), nil
+}
+
+// buildNDJSON sends every element of the body array as a json line
+func buildNDJSON(request Request) (additionalHeaders map[string]string, body io.Reader, err error) {
+	additionalHeaders = make(map[string]string, 0)
+	additionalHeaders["Content-Type"] = "application/x-ndjson"
+
+	lines, ok := request.Body.([]interface{})
+	if !ok {
+		return additionalHeaders, body, fmt.Errorf("ndjson body should be an array")
+	}
+	buf := new(bytes.Buffer)
+	for _, line := range lines {
+		lineBytes, err := json.Marshal(line)
+		if err != nil {
+			return additionalHeaders, body, fmt.Errorf("error marshaling ndjson line: %s", err)
+		}
+		buf.Write(lineBytes)
+		buf.WriteByte('\n')
+	}
+	return additionalHeaders, buf, nil
+}
+
 func buildFile(req Request) (map[string]string, io.Reader, error) {
 
 	headers := map[string]string{}
@@ -114,7 +517,7 @@ func buildFile(req Request) (map[string]string, io.Reader, error) {
 		return nil, nil, errors.New(`Request.buildFile: Missing "body_file"`)
 	}
 
-	_, file, err := util.OpenFileOrUrl(req.BodyFile, req.ManifestDir)
+	file, err := openBodyFile(req.BodyFile, req.ManifestDir)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -3,6 +3,7 @@ package api
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"strings"
 	"testing"
 
@@ -44,7 +45,7 @@ func TestBuildMultipart(t *testing.T) {
 func TestBuildMultipart_ErrPathSpec(t *testing.T) {
 	testRequest := Request{
 		Body: map[string]interface{}{
-			"somekey": fmt.Sprintf("noPathspec"),
+			"somekey": map[string]interface{}{"file": "noPathspec"},
 		},
 		ManifestDir: "test/path/",
 	}
@@ -61,7 +62,7 @@ func TestBuildMultipart_ErrPathSpec(t *testing.T) {
 func TestBuildMultipart_ErrPathSpecNoString(t *testing.T) {
 	testRequest := Request{
 		Body: map[string]interface{}{
-			"somekey": 1,
+			"somekey": map[string]interface{}{"file": 1},
 		},
 		ManifestDir: "test/path/",
 	}
@@ -91,3 +92,160 @@ func TestBuildMultipart_FileDoesNotExist(t *testing.T) {
 		t.Errorf("expected error because file does not exist")
 	}
 }
+
+func TestBuildGraphQL(t *testing.T) {
+	filesystem.Fs = afero.NewMemMapFs()
+	afero.WriteFile(filesystem.Fs, "test/user.graphql", []byte("query User($id: ID!) { user(id: $id) { name } }"), 0644)
+
+	testRequest := Request{
+		Body: map[string]interface{}{
+			"query":         "@user.graphql",
+			"variables":     map[string]interface{}{"id": 1},
+			"operationName": "User",
+		},
+		ManifestDir: "test/",
+		BodyType:    "graphql",
+	}
+
+	httpRequest, err := testRequest.buildHttpRequest()
+	go_test_utils.ExpectNoError(t, err, "error building graphql request")
+
+	body, err := ioutil.ReadAll(httpRequest.Body)
+	go_test_utils.ExpectNoError(t, err, "error reading body")
+	go_test_utils.AssertStringEquals(t, `{"operationName":"User","query":"query User($id: ID!) { user(id: $id) { name } }","variables":{"id":1}}`, string(body))
+	go_test_utils.AssertStringEquals(t, "application/json", httpRequest.Header.Get("Content-Type"))
+
+	testRequest.Body = map[string]interface{}{"variables": map[string]interface{}{}}
+	_, _, err = buildGraphQL(testRequest)
+	go_test_utils.ExpectError(t, err, "expected error for missing query")
+}
+
+func TestBuildMultipartMixed(t *testing.T) {
+	filesystem.Fs = afero.NewMemMapFs()
+	afero.WriteFile(filesystem.Fs, "test/a.txt", []byte("file a"), 0644)
+	afero.WriteFile(filesystem.Fs, "test/b.png", []byte("file b"), 0644)
+
+	testRequest := Request{
+		Body: map[string]interface{}{
+			"count": 2.0,
+			"files": []interface{}{
+				"@a.txt",
+				map[string]interface{}{"file": "@b.png", "filename": "image.png", "content_type": "image/png"},
+			},
+			"meta": map[string]interface{}{"json": map[string]interface{}{"title": "x"}, "header": map[string]interface{}{"X-Part": "1"}},
+			"name": "apitest",
+		},
+		ManifestDir: "test/",
+		BodyType:    "multipart",
+	}
+
+	httpRequest, err := testRequest.buildHttpRequest()
+	go_test_utils.ExpectNoError(t, err, "error building multipart request")
+	reader, err := httpRequest.MultipartReader()
+	go_test_utils.ExpectNoError(t, err, "error getting multipart reader from request")
+
+	expected := []struct {
+		name, filename, contentType, content string
+	}{
+		{"count", "", "", "2"},
+		{"files", "a.txt", "application/octet-stream", "file a"},
+		{"files", "image.png", "image/png", "file b"},
+		{"meta", "", "application/json", `{"title":"x"}`},
+		{"name", "", "", "apitest"},
+	}
+	for _, e := range expected {
+		part, err := reader.NextPart()
+		go_test_utils.ExpectNoError(t, err, "error reading part "+e.name)
+		go_test_utils.AssertStringEquals(t, e.name, part.FormName())
+		go_test_utils.AssertStringEquals(t, e.filename, part.FileName())
+		go_test_utils.AssertStringEquals(t, e.contentType, part.Header.Get("Content-Type"))
+		content, _ := ioutil.ReadAll(part)
+		go_test_utils.AssertStringEquals(t, e.content, string(content))
+		if e.name == "meta" {
+			go_test_utils.AssertStringEquals(t, "1", part.Header.Get("X-Part"))
+		}
+	}
+
+	curl := testRequest.ToString(true)
+	for _, arg := range []string{
+		`--form-string 'count=2'`,
+		`-F 'files=@test/a.txt'`,
+		`-F 'files=@test/b.png;filename="image.png";type=image/png'`,
+		`-F 'meta="{\"title\":\"x\"}";type=application/json;headers="X-Part: 1"'`,
+		`--form-string 'name=apitest'`,
+	} {
+		if !strings.Contains(curl, arg) {
+			t.Errorf("expected %s in curl: %s", arg, curl)
+		}
+	}
+
+	testRequest.Body = map[string]interface{}{"meta": map[string]interface{}{"json": 1.0, "value": "x"}}
+	_, _, err = buildMultipart(testRequest)
+	go_test_utils.ExpectError(t, err, "expected error for part with json and value")
+}
+
+func TestBuildBodyTypes(t *testing.T) {
+	filesystem.Fs = afero.NewMemMapFs()
+	afero.WriteFile(filesystem.Fs, "test/body.xml", []byte("<a>file</a>"), 0644)
+
+	tests := []struct {
+		bodyType    string
+		body        interface{}
+		contentType string
+		expected    string
+	}{
+		{
+			"xml",
+			map[string]interface{}{"user": map[string]interface{}{"-id": "1", "name": "x", "tag": []interface{}{"a", "b"}}},
+			"application/xml",
+			`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<user id="1"><name>x</name><tag>a</tag><tag>b</tag></user>`,
+		},
+		{"xml", "@body.xml", "application/xml", "<a>file</a>"},
+		{"text", "hello world", "text/plain; charset=utf-8", "hello world"},
+		{"raw", "AAEC/w==", "application/octet-stream", "\x00\x01\x02\xff"},
+		{
+			"ndjson",
+			[]interface{}{map[string]interface{}{"a": 1.0}, "b", 2.5},
+			"application/x-ndjson",
+			"{\"a\":1}\n\"b\"\n2.5\n",
+		},
+		{
+			"urlencoded",
+			map[string]interface{}{
+				"tag":   []interface{}{"a", "b"},
+				"n":     2.0,
+				"ok":    true,
+				"user":  map[string]interface{}{"name": "x", "roles": []interface{}{"admin", "dev"}},
+				"items": []interface{}{map[string]interface{}{"id": 1.0}},
+			},
+			"application/x-www-form-urlencoded",
+			"items%5B0%5D%5Bid%5D=1&n=2&ok=true&tag=a&tag=b&user%5Bname%5D=x&user%5Broles%5D=admin&user%5Broles%5D=dev",
+		},
+	}
+
+	for _, tc := range tests {
+		testRequest := Request{
+			Body:        tc.body,
+			BodyType:    tc.bodyType,
+			ManifestDir: "test/",
+		}
+		httpRequest, err := testRequest.buildHttpRequest()
+		go_test_utils.ExpectNoError(t, err, "error building "+tc.bodyType+" request")
+
+		body, err := ioutil.ReadAll(httpRequest.Body)
+		go_test_utils.ExpectNoError(t, err, "error reading body")
+		go_test_utils.AssertStringEquals(t, tc.expected, string(body))
+		go_test_utils.AssertStringEquals(t, tc.contentType, httpRequest.Header.Get("Content-Type"))
+	}
+
+	for bodyType, body := range map[string]interface{}{
+		"xml":        map[string]interface{}{"a": 1.0, "b": 2.0},
+		"text":       1.0,
+		"raw":        "no base64!",
+		"ndjson":     map[string]interface{}{},
+		"urlencoded": []interface{}{"a"},
+	} {
+		_, err := (Request{Body: body, BodyType: bodyType}).buildHttpRequest()
+		go_test_utils.ExpectError(t, err, "expected error for "+bodyType+" body")
+	}
+}
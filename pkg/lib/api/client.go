@@ -0,0 +1,313 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/programmfabrik/apitest/pkg/lib/filesystem"
+	"github.com/programmfabrik/apitest/pkg/lib/util"
+	"github.com/spf13/afero"
+	"golang.org/x/net/http2"
+)
+
+// ClientConfig configures the http client that sends the requests. It is used for
+// the apitest.http section of the config and the http block of single requests.
+// Unset values are taken from the config, or the defaults
+type ClientConfig struct {
+	// PEM files, relative to the manifest for requests
+	CACert     string `mapstructure:"ca_cert" json:"ca_cert,omitempty"`
+	ClientCert string `mapstructure:"client_cert" json:"client_cert,omitempty"`
+	ClientKey  string `mapstructure:"client_key" json:"client_key,omitempty"`
+
+	// Server certificates are not verified by default
+	VerifyTLS *bool `mapstructure:"verify_tls" json:"verify_tls,omitempty"`
+
+	// Defaults: no connect timeout, 5 minutes total
+	ConnectTimeoutMs int `mapstructure:"connect_timeout_ms" json:"connect_timeout_ms,omitempty"`
+	TimeoutMs        int `mapstructure:"timeout_ms" json:"timeout_ms,omitempty"`
+
+	// Connections are closed after every request by default
+	KeepAlive *bool `mapstructure:"keep_alive" json:"keep_alive,omitempty"`
+
+	// URL of a http proxy
+	Proxy string `mapstructure:"proxy" json:"proxy,omitempty"`
+
+	// Redirects are followed by default, up to 10 times
+	FollowRedirects *bool `mapstructure:"follow_redirects" json:"follow_redirects,omitempty"`
+	MaxRedirects    int   `mapstructure:"max_redirects" json:"max_redirects,omitempty"`
+
+	// "http/1.1" (default), "h2" (HTTP/2 over TLS) or "h2c" (HTTP/2 without TLS)
+	Protocol string `mapstructure:"protocol" json:"protocol,omitempty"`
+}
+
+const (
+	defaultTimeout      = 5 * time.Minute
+	defaultMaxRedirects = 10
+)
+
+var (
+	defaultClientConfig ClientConfig
+
+	clientsM sync.Mutex
+	clients  = map[string]*http.Client{}
+)
+
+// SetDefaultClientConfig sets the client config for all requests that do not overwrite it
+func SetDefaultClientConfig(config ClientConfig) {
+	clientsM.Lock()
+	defer clientsM.Unlock()
+
+	defaultClientConfig = config
+}
+
+// merge returns the config with all values that are set in other overwritten
+func (config ClientConfig) merge(other *ClientConfig) ClientConfig {
+	if other == nil {
+		return config
+	}
+	if other.CACert != "" {
+		config.CACert = other.CACert
+	}
+	if other.ClientCert != "" {
+		config.ClientCert = other.ClientCert
+	}
+	if other.ClientKey != "" {
+		config.ClientKey = other.ClientKey
+	}
+	if other.VerifyTLS != nil {
+		config.VerifyTLS = other.VerifyTLS
+	}
+	if other.ConnectTimeoutMs != 0 {
+		config.ConnectTimeoutMs = other.ConnectTimeoutMs
+	}
+	if other.TimeoutMs != 0 {
+		config.TimeoutMs = other.TimeoutMs
+	}
+	if other.KeepAlive != nil {
+		config.KeepAlive = other.KeepAlive
+	}
+	if other.Proxy != "" {
+		config.Proxy = other.Proxy
+	}
+	if other.FollowRedirects != nil {
+		config.FollowRedirects = other.FollowRedirects
+	}
+	if other.MaxRedirects != 0 {
+		config.MaxRedirects = other.MaxRedirects
+	}
+	if other.Protocol != "" {
+		config.Protocol = other.Protocol
+	}
+	return config
+}
+
+func (config ClientConfig) keepAlive() bool {
+	return config.KeepAlive != nil && *config.KeepAlive
+}
+
+func (config ClientConfig) http2() bool {
+	return config.Protocol == "h2" || config.Protocol == "h2c"
+}
+
+// clientConfig returns the config of the request merged into the default config.
+// Paths of the request are made relative to its manifest
+func (request Request) clientConfig() ClientConfig {
+	clientsM.Lock()
+	config := defaultClientConfig
+	clientsM.Unlock()
+
+	if request.HTTP != nil {
+		override := *request.HTTP
+		for _, path := range []*string{&override.CACert, &override.ClientCert, &override.ClientKey} {
+			if *path != "" {
+				*path = util.LocalPath(*path, request.ManifestDir)
+			}
+		}
+		config = config.merge(&override)
+	}
+
+	// follow_redirects, max_redirects and protocol can be set directly in the request as well
+	return config.merge(&ClientConfig{
+		FollowRedirects: request.FollowRedirects,
+		MaxRedirects:    request.MaxRedirects,
+		Protocol:        request.Protocol,
+	})
+}
+
+// client returns the http client for the config. Clients are reused, so
+// connections can be kept alive
+func (config ClientConfig) client() (*http.Client, error) {
+	key, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	clientsM.Lock()
+	defer clientsM.Unlock()
+
+	if c, ok := clients[string(key)]; ok {
+		return c, nil
+	}
+	c, err := config.newClient()
+	if err != nil {
+		return nil, err
+	}
+	clients[string(key)] = c
+	return c, nil
+}
+
+// TLSConfig returns the tls settings of the request, for connections that are not
+// made by the http client, like websockets
+func (request Request) TLSConfig() (*tls.Config, error) {
+	return request.clientConfig().tlsConfig()
+}
+
+// tlsConfig returns the tls settings of the config, with the certificates loaded
+func (config ClientConfig) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.VerifyTLS == nil || !*config.VerifyTLS,
+	}
+
+	if config.CACert != "" {
+		pem, err := afero.ReadFile(filesystem.Fs, config.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("could not read ca_cert: %s", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ca_cert '%s'", config.CACert)
+		}
+	}
+
+	if config.ClientCert != "" || config.ClientKey != "" {
+		certPEM, err := afero.ReadFile(filesystem.Fs, config.ClientCert)
+		if err != nil {
+			return nil, fmt.Errorf("could not read client_cert: %s", err)
+		}
+		keyPEM, err := afero.ReadFile(filesystem.Fs, config.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("could not read client_key: %s", err)
+		}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+func (config ClientConfig) newClient() (*http.Client, error) {
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout: time.Duration(config.ConnectTimeoutMs) * time.Millisecond,
+	}
+
+	var tr http.RoundTripper
+	switch config.Protocol {
+	case "", "http/1.1":
+		httpTr := &http.Transport{
+			TLSClientConfig: tlsConfig,
+			// We need to avoid the automatically set gzip header
+			DisableCompression: true,
+			DisableKeepAlives:  !config.keepAlive(),
+			DialContext:        dialer.DialContext,
+		}
+		if config.Proxy != "" {
+			proxyURL, err := url.Parse(config.Proxy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid proxy '%s': %s", config.Proxy, err)
+			}
+			httpTr.Proxy = http.ProxyURL(proxyURL)
+		}
+		tr = httpTr
+	case "h2", "h2c":
+		if config.Proxy != "" {
+			return nil, fmt.Errorf("proxy is not supported with protocol '%s'", config.Protocol)
+		}
+		h2Tr := &http2.Transport{
+			TLSClientConfig:    tlsConfig,
+			DisableCompression: true,
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return tls.DialWithDialer(dialer, network, addr, cfg)
+			},
+		}
+		if config.Protocol == "h2c" {
+			// HTTP/2 with prior knowledge on an unencrypted connection
+			h2Tr.AllowHTTP = true
+			h2Tr.DialTLS = func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return dialer.Dial(network, addr)
+			}
+		}
+		tr = h2Tr
+	default:
+		return nil, fmt.Errorf("unknown protocol '%s', use http/1.1, h2 or h2c", config.Protocol)
+	}
+
+	timeout := defaultTimeout
+	if config.TimeoutMs > 0 {
+		timeout = time.Duration(config.TimeoutMs) * time.Millisecond
+	}
+
+	follow := config.FollowRedirects == nil || *config.FollowRedirects
+	maxRedirects := defaultMaxRedirects
+	if config.MaxRedirects > 0 {
+		maxRedirects = config.MaxRedirects
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: tr,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !follow {
+				return http.ErrUseLastResponse
+			}
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}, nil
+}
+
+// Redirect is a single hop of the redirects that were followed for a request.
+// Empty values are omitted, so expected redirects only check the keys they set
+type Redirect struct {
+	StatusCode int    `json:"statuscode,omitempty"`
+	URL        string `json:"url,omitempty"`
+	Location   string `json:"location,omitempty"`
+}
+
+// redirectChain returns the redirects that led to the response, in the order
+// they were followed. The client keeps the redirect response of every hop in
+// the request that followed it
+func redirectChain(httpResponse *http.Response) []Redirect {
+	chain := []Redirect{}
+	for req := httpResponse.Request; req != nil && req.Response != nil; req = req.Response.Request {
+		res := req.Response
+		redirect := Redirect{
+			StatusCode: res.StatusCode,
+			Location:   res.Header.Get("Location"),
+		}
+		if res.Request != nil {
+			redirect.URL = res.Request.URL.String()
+		}
+		chain = append([]Redirect{redirect}, chain...)
+	}
+	if len(chain) == 0 {
+		return nil
+	}
+	return chain
+}
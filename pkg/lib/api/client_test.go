@@ -0,0 +1,218 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/programmfabrik/apitest/pkg/lib/filesystem"
+	go_test_utils "github.com/programmfabrik/go-test-utils"
+	"github.com/spf13/afero"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestClientConfigMerge(t *testing.T) {
+	config := ClientConfig{TimeoutMs: 1000, KeepAlive: boolPtr(true), Proxy: "http://proxy"}
+	merged := config.merge(&ClientConfig{TimeoutMs: 50, KeepAlive: boolPtr(false)})
+
+	go_test_utils.AssertIntEquals(t, 50, merged.TimeoutMs)
+	go_test_utils.AssertStringEquals(t, "http://proxy", merged.Proxy)
+	if merged.keepAlive() {
+		t.Error("Expected keep_alive to be overwritten")
+	}
+}
+
+func TestClientTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	filesystem.Fs = afero.NewMemMapFs()
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	afero.WriteFile(filesystem.Fs, "manifest/ca.pem", caPEM, 0644)
+
+	tests := []struct {
+		http    *ClientConfig
+		success bool
+	}{
+		{nil, true},
+		{&ClientConfig{VerifyTLS: boolPtr(true)}, false},
+		{&ClientConfig{VerifyTLS: boolPtr(true), CACert: "ca.pem"}, true},
+	}
+
+	for i, tc := range tests {
+		request := Request{ServerURL: ts.URL, Method: "GET", ManifestDir: "manifest", HTTP: tc.http}
+		_, err := request.Send()
+		if (err == nil) != tc.success {
+			t.Errorf("%d: expected success=%v, got error: %v", i, tc.success, err)
+		}
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	ts.StartTLS()
+	defer ts.Close()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	go_test_utils.ExpectNoError(t, err, "error generating key")
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "apitest"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	go_test_utils.ExpectNoError(t, err, "error creating certificate")
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	go_test_utils.ExpectNoError(t, err, "error marshaling key")
+
+	filesystem.Fs = afero.NewMemMapFs()
+	afero.WriteFile(filesystem.Fs, "client.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0644)
+	afero.WriteFile(filesystem.Fs, "client.key", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0644)
+
+	request := Request{ServerURL: ts.URL, Method: "GET"}
+	_, err = request.Send()
+	go_test_utils.ExpectError(t, err, "expected error without client certificate")
+
+	request.HTTP = &ClientConfig{ClientCert: "client.pem", ClientKey: "client.key"}
+	response, err := request.Send()
+	go_test_utils.ExpectNoError(t, err, "error sending request with client certificate")
+	go_test_utils.AssertIntEquals(t, http.StatusOK, response.StatusCode())
+}
+
+func TestClientRedirects(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case "/b":
+			http.Redirect(w, r, "/c", http.StatusFound)
+		}
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		http   *ClientConfig
+		status int
+		err    bool
+	}{
+		{nil, http.StatusOK, false},
+		{&ClientConfig{FollowRedirects: boolPtr(false)}, http.StatusFound, false},
+		{&ClientConfig{MaxRedirects: 1}, 0, true},
+	}
+
+	for i, tc := range tests {
+		request := Request{ServerURL: ts.URL, Endpoint: "a", Method: "GET", HTTP: tc.http}
+		response, err := request.Send()
+		if (err != nil) != tc.err {
+			t.Errorf("%d: unexpected error: %v", i, err)
+			continue
+		}
+		if !tc.err {
+			go_test_utils.AssertIntEquals(t, tc.status, response.StatusCode())
+		}
+	}
+}
+
+func TestRedirectChain(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.Redirect(w, r, "/session", http.StatusFound)
+		case "/session":
+			http.Redirect(w, r, "/home", http.StatusMovedPermanently)
+		}
+	}))
+	defer ts.Close()
+
+	request := Request{ServerURL: ts.URL, Endpoint: "login", Method: "GET"}
+	response, err := request.Send()
+	go_test_utils.ExpectNoError(t, err, "error sending request")
+
+	redirects := response.Redirects()
+	go_test_utils.AssertIntEquals(t, 2, len(redirects))
+	go_test_utils.AssertIntEquals(t, http.StatusFound, redirects[0].StatusCode)
+	go_test_utils.AssertStringEquals(t, ts.URL+"/login", redirects[0].URL)
+	go_test_utils.AssertStringEquals(t, "/session", redirects[0].Location)
+	go_test_utils.AssertIntEquals(t, http.StatusMovedPermanently, redirects[1].StatusCode)
+	go_test_utils.AssertStringEquals(t, ts.URL+"/session", redirects[1].URL)
+	go_test_utils.AssertStringEquals(t, "/home", redirects[1].Location)
+
+	generic, err := response.ServerResponseToGenericJSON(ResponseFormat{IgnoreBody: true}, false)
+	go_test_utils.ExpectNoError(t, err, "error converting response")
+	chain := generic.(map[string]interface{})["redirects"].([]interface{})
+	go_test_utils.AssertIntEquals(t, 2, len(chain))
+
+	request.FollowRedirects = boolPtr(false)
+	response, err = request.Send()
+	go_test_utils.ExpectNoError(t, err, "error sending request")
+	go_test_utils.AssertIntEquals(t, http.StatusFound, response.StatusCode())
+	go_test_utils.AssertStringEquals(t, "/session", response.headers["Location"][0])
+	if response.Redirects() != nil {
+		t.Errorf("Expected no redirects, got %v", response.Redirects())
+	}
+
+	request.FollowRedirects = nil
+	request.MaxRedirects = 1
+	_, err = request.Send()
+	go_test_utils.ExpectError(t, err, "expected error after too many redirects")
+}
+
+func TestClientProtocol(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tlsServer := httptest.NewUnstartedServer(handler)
+	tlsServer.EnableHTTP2 = true
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+
+	h2cServer := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	defer h2cServer.Close()
+
+	tests := []struct {
+		serverURL string
+		protocol  string
+		proto     string
+	}{
+		{tlsServer.URL, "", "HTTP/1.1"},
+		{tlsServer.URL, "http/1.1", "HTTP/1.1"},
+		{tlsServer.URL, "h2", "HTTP/2.0"},
+		{h2cServer.URL, "", "HTTP/1.1"},
+		{h2cServer.URL, "h2c", "HTTP/2.0"},
+	}
+
+	for _, tc := range tests {
+		request := Request{ServerURL: tc.serverURL, Method: "GET", Protocol: tc.protocol}
+		response, err := request.Send()
+		go_test_utils.ExpectNoError(t, err, "error sending request with protocol "+tc.protocol)
+		go_test_utils.AssertStringEquals(t, tc.proto, response.Proto())
+
+		generic, err := response.ServerResponseToGenericJSON(ResponseFormat{IgnoreBody: true}, false)
+		go_test_utils.ExpectNoError(t, err, "error converting response")
+		go_test_utils.AssertStringEquals(t, tc.proto, generic.(map[string]interface{})["proto"].(string))
+	}
+
+	request := Request{ServerURL: h2cServer.URL, Method: "GET", Protocol: "h3"}
+	_, err := request.Send()
+	go_test_utils.ExpectError(t, err, "expected error for unknown protocol")
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
+	"github.com/jhump/protoreflect/grpcreflect"
+	"github.com/programmfabrik/apitest/pkg/lib/filesystem"
+	"github.com/spf13/afero"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCRequest calls a unary gRPC method instead of sending a http request. The
+// method is resolved by server reflection, or from the .proto files in ProtoDir
+type GRPCRequest struct {
+	Service  string            `yaml:"service" json:"service"` // fully qualified, like "helloworld.Greeter"
+	Method   string            `yaml:"method" json:"method"`
+	Message  interface{}       `yaml:"message" json:"message"`
+	Metadata map[string]string `yaml:"metadata" json:"metadata"`
+	ProtoDir string            `yaml:"proto_dir" json:"proto_dir"` // relative to the manifest
+}
+
+// sendGRPC calls the method and returns the result like a http response. The
+// response message is the body, the header and trailer metadata are the headers,
+// and the status is in the "grpc-status" and "grpc-message" headers. A status
+// other than OK is no error, so it can be checked
+func (request Request) sendGRPC() (response Response, err error) {
+	grpcReq := request.GRPC
+	config := request.clientConfig()
+
+	target, useTLS, err := grpcTarget(request.ServerURL)
+	if err != nil {
+		return response, err
+	}
+
+	timeout := defaultTimeout
+	if config.TimeoutMs > 0 {
+		timeout = time.Duration(config.TimeoutMs) * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	dialOpt := grpc.WithInsecure()
+	if useTLS {
+		tlsConfig, err := config.tlsConfig()
+		if err != nil {
+			return response, fmt.Errorf("Could not create tls config: %s", err)
+		}
+		dialOpt = grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))
+	}
+	conn, err := grpc.DialContext(ctx, target, dialOpt)
+	if err != nil {
+		return response, fmt.Errorf("Could not connect to '%s': %s", target, err)
+	}
+	defer conn.Close()
+
+	method, err := request.grpcMethod(ctx, conn)
+	if err != nil {
+		return response, err
+	}
+
+	msg := dynamic.NewMessage(method.GetInputType())
+	if grpcReq.Message != nil {
+		msgJSON, err := json.Marshal(grpcReq.Message)
+		if err != nil {
+			return response, fmt.Errorf("Could not marshal message: %s", err)
+		}
+		err = msg.UnmarshalJSON(msgJSON)
+		if err != nil {
+			return response, fmt.Errorf("Could not convert message to '%s': %s", method.GetInputType().GetFullyQualifiedName(), err)
+		}
+	}
+
+	if len(grpcReq.Metadata) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(grpcReq.Metadata))
+	}
+
+	var header, trailer metadata.MD
+	start := time.Now()
+	resMsg, err := grpcdynamic.NewStub(conn).InvokeRpc(ctx, method, msg, grpc.Header(&header), grpc.Trailer(&trailer))
+	duration := time.Since(start)
+
+	st, ok := status.FromError(err)
+	if !ok {
+		return response, fmt.Errorf("Could not call '%s/%s': %s", grpcReq.Service, grpcReq.Method, err)
+	}
+
+	headers := map[string][]string{}
+	for _, md := range []metadata.MD{header, trailer} {
+		for k, v := range md {
+			headers[k] = append(headers[k], v...)
+		}
+	}
+	headers["grpc-status"] = []string{strconv.Itoa(int(st.Code()))}
+	if st.Message() != "" {
+		headers["grpc-message"] = []string{st.Message()}
+	}
+
+	var body io.Reader = strings.NewReader("")
+	if resMsg != nil {
+		marshaler := jsonpb.Marshaler{OrigName: true, EmitDefaults: true}
+		resJSON, err := marshaler.MarshalToString(resMsg)
+		if err != nil {
+			return response, fmt.Errorf("Could not convert response message to json: %s", err)
+		}
+		body = strings.NewReader(resJSON)
+	}
+
+	response, err = NewResponse(200, headers, nil, body, nil, ResponseFormat{})
+	if err != nil {
+		return response, fmt.Errorf("error constructing response from grpc response")
+	}
+	response.duration = duration
+	return response, nil
+}
+
+// grpcTarget returns host:port of the server url and if tls is used. Schemes
+// are "grpc" and "http" without tls, "grpcs" and "https" with tls
+func grpcTarget(serverURL string) (string, bool, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid server url '%s': %s", serverURL, err)
+	}
+	switch u.Scheme {
+	case "grpc", "http":
+		return u.Host, false, nil
+	case "grpcs", "https":
+		return u.Host, true, nil
+	default:
+		return "", false, fmt.Errorf("unsupported scheme '%s' for grpc in server url '%s'", u.Scheme, serverURL)
+	}
+}
+
+// grpcMethod resolves the method of the request
+func (request Request) grpcMethod(ctx context.Context, conn *grpc.ClientConn) (*desc.MethodDescriptor, error) {
+	grpcReq := request.GRPC
+
+	var (
+		service *desc.ServiceDescriptor
+		err     error
+	)
+	if grpcReq.ProtoDir == "" {
+		refClient := grpcreflect.NewClient(ctx, rpb.NewServerReflectionClient(conn))
+		defer refClient.Reset()
+
+		service, err = refClient.ResolveService(grpcReq.Service)
+		if err != nil {
+			return nil, fmt.Errorf("Could not resolve service '%s' by reflection: %s", grpcReq.Service, err)
+		}
+	} else {
+		service, err = protoDirService(filepath.Join(request.ManifestDir, grpcReq.ProtoDir), grpcReq.Service)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	method := service.FindMethodByName(grpcReq.Method)
+	if method == nil {
+		return nil, fmt.Errorf("Method '%s' not found in service '%s'", grpcReq.Method, grpcReq.Service)
+	}
+	return method, nil
+}
+
+// protoDirService parses all .proto files in the directory and returns the service
+func protoDirService(dir, serviceName string) (*desc.ServiceDescriptor, error) {
+	protoFiles := []string{}
+	err := afero.Walk(filesystem.Fs, dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && filepath.Ext(path) == ".proto" {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			protoFiles = append(protoFiles, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not read proto_dir '%s': %s", dir, err)
+	}
+
+	parser := protoparse.Parser{
+		ImportPaths: []string{dir},
+		Accessor: func(filename string) (io.ReadCloser, error) {
+			return filesystem.Fs.Open(filename)
+		},
+	}
+	fds, err := parser.ParseFiles(protoFiles...)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse proto files in '%s': %s", dir, err)
+	}
+	for _, fd := range fds {
+		if service := fd.FindService(serviceName); service != nil {
+			return service, nil
+		}
+	}
+	return nil, fmt.Errorf("Service '%s' not found in proto_dir '%s'", serviceName, dir)
+}
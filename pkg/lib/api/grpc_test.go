@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/programmfabrik/apitest/pkg/lib/filesystem"
+	go_test_utils "github.com/programmfabrik/go-test-utils"
+	"github.com/spf13/afero"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+)
+
+const healthProto = `syntax = "proto3";
+package grpc.health.v1;
+
+message HealthCheckRequest {
+  string service = 1;
+}
+
+message HealthCheckResponse {
+  enum ServingStatus {
+    UNKNOWN = 0;
+    SERVING = 1;
+    NOT_SERVING = 2;
+    SERVICE_UNKNOWN = 3;
+  }
+  ServingStatus status = 1;
+}
+
+service Health {
+  rpc Check(HealthCheckRequest) returns (HealthCheckResponse);
+}
+`
+
+// echoMetadata sends the incoming "x-test" metadata back in the header
+func echoMetadata(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get("x-test"); len(v) > 0 {
+		grpc.SetHeader(ctx, metadata.Pairs("x-test", v[0]))
+	}
+	return handler(ctx, req)
+}
+
+func TestGRPC(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(grpc.UnaryInterceptor(echoMetadata))
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("db", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+	reflection.Register(server)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	filesystem.Fs = afero.NewMemMapFs()
+	afero.WriteFile(filesystem.Fs, "manifest/proto/health.proto", []byte(healthProto), 0644)
+
+	for _, protoDir := range []string{"", "proto"} {
+		request := Request{
+			ServerURL:   "grpc://" + lis.Addr().String(),
+			ManifestDir: "manifest",
+			GRPC: &GRPCRequest{
+				Service:  "grpc.health.v1.Health",
+				Method:   "Check",
+				Message:  map[string]interface{}{"service": "db"},
+				Metadata: map[string]string{"x-test": "hello"},
+				ProtoDir: protoDir,
+			},
+		}
+		response, err := request.Send()
+		go_test_utils.ExpectNoError(t, err, "error calling grpc with proto_dir '"+protoDir+"'")
+		go_test_utils.AssertStringEquals(t, `{"status":"NOT_SERVING"}`, string(response.Body()))
+		go_test_utils.AssertStringEquals(t, "0", response.headers["grpc-status"][0])
+		go_test_utils.AssertStringEquals(t, "hello", response.headers["x-test"][0])
+
+		// An unknown service is a NOT_FOUND status, not an error
+		request.GRPC.Message = map[string]interface{}{"service": "unknown"}
+		response, err = request.Send()
+		go_test_utils.ExpectNoError(t, err, "error calling grpc with proto_dir '"+protoDir+"'")
+		go_test_utils.AssertStringEquals(t, "5", response.headers["grpc-status"][0])
+
+		request.GRPC.Method = "Watch2"
+		_, err = request.Send()
+		go_test_utils.ExpectError(t, err, "expected error for unknown method")
+	}
+}
@@ -1,8 +1,8 @@
 package api
 
 import (
+	"bytes"
 	"compress/gzip"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,34 +10,17 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"path"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/moul/http2curl"
+	"github.com/programmfabrik/apitest/pkg/lib/cookiejar"
 	"github.com/programmfabrik/apitest/pkg/lib/datastore"
 	"github.com/programmfabrik/apitest/pkg/lib/util"
 )
 
-var httpClient *http.Client
-
-func init() {
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
-		// We need to avoid the automatically set gzip header
-		DisableCompression: true,
-	}
-
-	httpClient = &http.Client{
-		Timeout:   time.Minute * 5,
-		Transport: tr,
-	}
-}
-
 type RequestCookie struct {
 	ValueFromStore string `yaml:"value_from_store" json:"value_from_store"`
 	Value          string `yaml:"value" json:"value"`
@@ -55,12 +38,23 @@ type Request struct {
 	SetCookies           []*Cookie                 `yaml:"header-x-test-set-cookie" json:"header-x-test-set-cookie"`
 	BodyType             string                    `yaml:"body_type" json:"body_type"`
 	BodyFile             string                    `yaml:"body_file" json:"body_file"`
+	Chunked              bool                      `yaml:"chunked" json:"chunked"`
 	Body                 interface{}               `yaml:"body" json:"body"`
-
-	buildPolicy func(Request) (additionalHeaders map[string]string, body io.Reader, err error)
-	DoNotStore  bool
-	ManifestDir string
-	DataStore   *datastore.Datastore
+	HTTP                 *ClientConfig             `yaml:"http" json:"http"`
+	FollowRedirects      *bool                     `yaml:"follow_redirects" json:"follow_redirects"`
+	MaxRedirects         int                       `yaml:"max_redirects" json:"max_redirects"`
+	CookieJar            string                    `yaml:"cookie_jar" json:"cookie_jar"`
+	Protocol             string                    `yaml:"protocol" json:"protocol"`
+	GRPC                 *GRPCRequest              `yaml:"grpc" json:"grpc"`
+	Upload               *UploadConfig             `yaml:"upload" json:"upload"`
+	Auth                 *RequestAuth              `yaml:"auth" json:"auth"`
+
+	buildPolicy    func(Request) (additionalHeaders map[string]string, body io.Reader, err error)
+	DoNotStore     bool
+	ManifestDir    string
+	DataStore      *datastore.Datastore
+	CookieJars     *cookiejar.Jars
+	ResponseFormat ResponseFormat // format of the expected response, needed to read streams
 }
 
 func (request Request) buildHttpRequest() (req *http.Request, err error) {
@@ -73,17 +67,23 @@ func (request Request) buildHttpRequest() (req *http.Request, err error) {
 			request.buildPolicy = buildUrlencoded
 		case "file":
 			request.buildPolicy = buildFile
+		case "graphql":
+			request.buildPolicy = buildGraphQL
+		case "xml":
+			request.buildPolicy = buildXML
+		case "text":
+			request.buildPolicy = buildText
+		case "raw":
+			request.buildPolicy = buildRaw
+		case "ndjson":
+			request.buildPolicy = buildNDJSON
 		default:
 			request.buildPolicy = buildRegular
 		}
 	}
 	//Render Request Url
 
-	requestUrl := fmt.Sprintf("%s/%s", request.ServerURL, request.Endpoint)
-	if request.Endpoint == "" {
-		requestUrl = request.ServerURL
-	}
-
+	requestUrl := request.url()
 	reqUrl, err := url.Parse(requestUrl)
 	if err != nil {
 		return nil, errors.Wrapf(err, "Unable to buildHttpRequest with URL %q", requestUrl)
@@ -93,14 +93,30 @@ func (request Request) buildHttpRequest() (req *http.Request, err error) {
 	if err != nil {
 		return req, fmt.Errorf("error executing buildpolicy: %s", err)
 	}
+	defer func() {
+		// A streamed body holds open files, or a goroutine writing to it
+		if err != nil {
+			closeBody(body)
+		}
+	}()
 
 	req, err = http.NewRequest(request.Method, requestUrl, body)
 	if err != nil {
 		return req, fmt.Errorf("error creating new request")
 	}
+	if stream, ok := body.(streamBody); ok {
+		req.ContentLength = stream.size
+	}
+	if request.Chunked && req.Body != nil && req.Body != http.NoBody {
+		// A negative length is sent with chunked transfer encoding
+		req.ContentLength = -1
+	}
 	// Remove library default agent
 	req.Header.Set("User-Agent", "")
-	req.Close = true
+	clientConfig := request.clientConfig()
+	// Closing the connection after the request only applies to HTTP/1.x,
+	// the HTTP/2 transport can not reuse a connection marked as closing
+	req.Close = !clientConfig.keepAlive() && !clientConfig.http2()
 
 	if reqUrl.User != nil {
 		pw, ok := reqUrl.User.Password()
@@ -266,15 +282,49 @@ func (request Request) buildHttpRequest() (req *http.Request, err error) {
 	return req, nil
 }
 
+// closeBody closes the body of a request that is not sent
+func closeBody(body io.Reader) {
+	if closer, ok := body.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// url returns the url of the endpoint, without query parameters
+func (request Request) url() string {
+	if request.Endpoint == "" {
+		return request.ServerURL
+	}
+	return fmt.Sprintf("%s/%s", request.ServerURL, request.Endpoint)
+}
+
 func (request Request) ToString(curl bool) (res string) {
+	if request.GRPC != nil {
+		grpcBytes, err := json.MarshalIndent(request.GRPC, "", "  ")
+		if err != nil {
+			return fmt.Sprintf("could not marshal grpc request: %s", err)
+		}
+		return fmt.Sprintf("GRPC %s\n%s", request.ServerURL, grpcBytes)
+	}
+	if request.BodyType == "upload" {
+		// An upload is a sequence of requests, depending on the responses
+		uploadBytes, err := json.MarshalIndent(request.Upload, "", "  ")
+		if err != nil {
+			return fmt.Sprintf("could not marshal upload: %s", err)
+		}
+		return fmt.Sprintf("UPLOAD %s %s %s\n%s", request.BodyFile, request.Method, request.url(), uploadBytes)
+	}
+
 	httpRequest, err := request.buildHttpRequest()
 	if err != nil {
 		return fmt.Sprintf("could not build httpRequest: %s", err)
 	}
 
 	var dumpBody bool
-	if request.BodyType == "multipart" {
+	if request.BodyType == "multipart" || request.BodyType == "file" {
+		// Streamed bodies can be large, so they are not read
 		dumpBody = false
+		_ = httpRequest.Body.Close()
+		httpRequest.Body = http.NoBody
 	} else {
 		dumpBody = true
 	}
@@ -289,19 +339,20 @@ func (request Request) ToString(curl bool) (res string) {
 			// return r.Replace(curl.String())
 		}
 
-		_, _ = io.Copy(ioutil.Discard, httpRequest.Body)
-		_ = httpRequest.Body.Close()
-
 		curl, _ := http2curl.GetCurlCommand(httpRequest)
 		cString := curl.String()
 
 		rep := ""
-		for key, val := range request.Body.(map[string]interface{}) {
-			pathSpec, ok := val.(util.JsonString)
-			if !ok {
-				panic(fmt.Errorf("pathSpec should be a string"))
+		if request.BodyType == "file" {
+			rep = " --data-binary " + curlDataFile(request.BodyFile, request.ManifestDir)
+		} else {
+			fields, err := multipartFields(request)
+			if err != nil {
+				return fmt.Sprintf("could not build multipart fields: %s", err)
+			}
+			for _, field := range fields {
+				rep += " " + field.curlArg(request.ManifestDir)
 			}
-			rep = fmt.Sprintf(`%s -F "%s=@%s"`, rep, key, path.Join(request.ManifestDir, pathSpec[1:]))
 		}
 		// return r.Replace(strings.Replace(cString, " -d ''", rep, 1))
 		return strings.Replace(cString, " -d ''", rep, 1)
@@ -315,12 +366,49 @@ func (request Request) ToString(curl bool) (res string) {
 }
 
 func (request Request) Send() (response Response, err error) {
+	if request.GRPC != nil {
+		return request.sendGRPC()
+	}
+
+	if request.BodyType == "upload" {
+		return request.sendUpload()
+	}
+
 	httpRequest, err := request.buildHttpRequest()
 	if err != nil {
 		return response, fmt.Errorf("Could not buildHttpRequest: %s", err)
 	}
+	return request.do(httpRequest)
+}
+
+// do signs and sends the http request with the client of the request and reads
+// the response. Signing is left out of buildHttpRequest, so logging the request
+// does not read the body
+func (request Request) do(httpRequest *http.Request) (response Response, err error) {
+	if request.Auth != nil {
+		// The signature is computed over the final request
+		err = request.Auth.sign(httpRequest, request.ManifestDir)
+		if err != nil {
+			return response, fmt.Errorf("Could not sign request: %s", err)
+		}
+	}
+
+	client, err := request.clientConfig().client()
+	if err != nil {
+		return response, fmt.Errorf("Could not create http client: %s", err)
+	}
+	if request.CookieJar != "" {
+		if request.CookieJars == nil {
+			return response, fmt.Errorf("Cookie jar '%s' is not available", request.CookieJar)
+		}
+		// The cached client is shared, so the jar is set on a copy
+		jarClient := *client
+		jarClient.Jar = request.CookieJars.Get(request.CookieJar)
+		client = &jarClient
+	}
 
-	httpResponse, err := httpClient.Do(httpRequest)
+	start := time.Now()
+	httpResponse, err := client.Do(httpRequest)
 	if err != nil {
 		return response, fmt.Errorf("Could not do http request: %s", err)
 	}
@@ -348,9 +436,30 @@ func (request Request) Send() (response Response, err error) {
 		reader = httpResponse.Body
 	}
 
+	if request.ResponseFormat.Type == "sse" {
+		// A stream does not end, so only the expected events are read and converted into json
+		sse := request.ResponseFormat.SSE
+		timeoutMs := sse.TimeoutMs
+		if timeoutMs <= 0 {
+			timeoutMs = defaultSSETimeoutMs
+		}
+		events, err := readSSE(reader, httpResponse.Body, sse.Events, time.Duration(timeoutMs)*time.Millisecond)
+		if err != nil {
+			return response, fmt.Errorf("error reading event stream: %s", err)
+		}
+		eventsJSON, err := json.Marshal(events)
+		if err != nil {
+			return response, err
+		}
+		reader = ioutil.NopCloser(bytes.NewReader(eventsJSON))
+	}
+
 	response, err = NewResponse(httpResponse.StatusCode, httpResponse.Header, httpResponse.Cookies(), reader, nil, ResponseFormat{})
 	if err != nil {
 		return response, fmt.Errorf("error constructing response from http response")
 	}
+	response.duration = time.Since(start)
+	response.redirects = redirectChain(httpResponse)
+	response.proto = httpResponse.Proto
 	return response, err
 }
@@ -28,6 +28,13 @@ type Response struct {
 	body        []byte
 	bodyControl util.JsonObject
 	Format      ResponseFormat
+
+	timing    *Timing       // expected, only set for responses from a spec
+	duration  time.Duration // measured by Request.Send
+	redirects []Redirect
+	proto     string // protocol of the response, like "HTTP/2.0"
+
+	redirectsControl util.JsonObject
 }
 
 // Cookie definition
@@ -50,14 +57,29 @@ type ResponseSerialization struct {
 	Body        interface{}         `yaml:"body" json:"body,omitempty"`
 	BodyControl util.JsonObject     `yaml:"body:control" json:"body:control,omitempty"`
 	Format      ResponseFormat      `yaml:"format" json:"format,omitempty"`
+	Timing      *Timing             `yaml:"timing" json:"timing,omitempty"`
+	Redirects   []Redirect          `yaml:"redirects" json:"redirects,omitempty"`
+	Proto       string              `yaml:"proto" json:"proto,omitempty"`
+
+	RedirectsControl util.JsonObject `yaml:"redirects:control" json:"redirects:control,omitempty"`
+}
+
+// Timing limits the time a request or a whole suite may take
+type Timing struct {
+	MaxMs int `json:"max_ms"`
 }
 
 type ResponseFormat struct {
 	IgnoreBody bool   `json:"-"`    // if true, do not try to parse the body (since it is not expected in the response)
-	Type       string `json:"type"` // default "json", allowed: "csv", "json", "xml", "binary"
+	Type       string `json:"type"` // default "json", allowed: "csv", "json", "xml", "binary", "sse"
 	CSV        struct {
 		Comma string `json:"comma,omitempty"`
 	} `json:"csv,omitempty"`
+	// Server-sent events are read until the number of events is received or the timeout fires
+	SSE struct {
+		Events    int `json:"events,omitempty"`
+		TimeoutMs int `json:"timeout_ms,omitempty"`
+	} `json:"sse,omitempty"`
 	PreProcess *PreProcess `json:"pre_process,omitempty"`
 }
 
@@ -98,7 +120,12 @@ func NewResponseFromSpec(spec ResponseSerialization) (res Response, err error) {
 		}
 	}
 
-	return NewResponse(spec.StatusCode, spec.Headers, cookies, bytes.NewReader(bodyBytes), spec.BodyControl, spec.Format)
+	res, err = NewResponse(spec.StatusCode, spec.Headers, cookies, bytes.NewReader(bodyBytes), spec.BodyControl, spec.Format)
+	res.timing = spec.Timing
+	res.redirects = spec.Redirects
+	res.redirectsControl = spec.RedirectsControl
+	res.proto = spec.Proto
+	return res, err
 }
 
 // ServerResponseToGenericJSON parse response from server. convert xml, csv, binary to json if necessary
@@ -159,6 +186,9 @@ func (response Response) ServerResponseToGenericJSON(responseFormat ResponseForm
 		if err != nil {
 			return res, errors.Wrap(err, "Could not marshal body with md5sum to json")
 		}
+	case "sse":
+		// The events were already converted into json when the stream was read
+		bodyData = resp.Body()
 	case "":
 		// no specific format, we assume a json, and thereby try to unmarshal it into our body
 		bodyData = resp.Body()
@@ -168,6 +198,8 @@ func (response Response) ServerResponseToGenericJSON(responseFormat ResponseForm
 
 	responseJSON := ResponseSerialization{
 		StatusCode: resp.statusCode,
+		Redirects:  resp.redirects,
+		Proto:      resp.proto,
 	}
 	if len(resp.headers) > 0 {
 		responseJSON.Headers = resp.headers
@@ -237,6 +269,10 @@ func (response Response) ToGenericJSON() (interface{}, error) {
 	responseJSON := ResponseSerialization{
 		StatusCode:  response.statusCode,
 		BodyControl: response.bodyControl,
+		Redirects:   response.redirects,
+		Proto:       response.proto,
+
+		RedirectsControl: response.redirectsControl,
 	}
 	if len(response.headers) > 0 {
 		responseJSON.Headers = response.headers
@@ -288,6 +324,35 @@ func (response Response) ServerResponseToJsonString(bodyOnly bool) (string, erro
 	return string(bytes), nil
 }
 
+func (response Response) StatusCode() int {
+	return response.statusCode
+}
+
+// Timing returns the expected timing of a response loaded from a spec
+func (response Response) Timing() *Timing {
+	return response.timing
+}
+
+// Duration returns the time it took to send the request and read this response
+func (response Response) Duration() time.Duration {
+	return response.duration
+}
+
+// Redirects returns the redirects that were followed to get this response
+func (response Response) Redirects() []Redirect {
+	return response.redirects
+}
+
+// Proto returns the protocol of the response, like "HTTP/1.1" or "HTTP/2.0"
+func (response Response) Proto() string {
+	return response.proto
+}
+
+// header returns the first value of the header
+func (response Response) header(key string) string {
+	return http.Header(response.headers).Get(key)
+}
+
 func (response Response) Body() []byte {
 	// some endpoints return empty strings;
 	// since that is no valid json so we interpret it as the json null literal to
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const defaultSSETimeoutMs = 10000
+
+// SSEEvent is a single event of a text/event-stream response
+type SSEEvent struct {
+	Event string      `json:"event"`
+	ID    string      `json:"id"`
+	Data  interface{} `json:"data"`
+}
+
+// readSSE reads events from the stream until count events are read (all if count
+// is 0), the stream ends or the timeout fires. The body is closed to stop reading
+// after the timeout, which is no error. Data that is json is parsed, other data
+// is kept as string
+func readSSE(body io.Reader, closer io.Closer, count int, timeout time.Duration) ([]SSEEvent, error) {
+	var timedOut int32
+	timer := time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&timedOut, 1)
+		closer.Close()
+	})
+	defer timer.Stop()
+
+	events := []SSEEvent{}
+	var (
+		eventType, lastID string
+		data              []string
+	)
+
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// A blank line dispatches the event, if it has data
+			if len(data) > 0 {
+				event := SSEEvent{Event: eventType, ID: lastID}
+				if event.Event == "" {
+					event.Event = "message"
+				}
+				dataStr := strings.Join(data, "\n")
+				if json.Unmarshal([]byte(dataStr), &event.Data) != nil {
+					event.Data = dataStr
+				}
+				events = append(events, event)
+				if count > 0 && len(events) >= count {
+					return events, nil
+				}
+			}
+			eventType = ""
+			data = nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			// comment
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "event":
+			eventType = value
+		case "data":
+			data = append(data, value)
+		case "id":
+			// the id is kept for the following events, like in browsers
+			lastID = value
+		}
+	}
+
+	err := scanner.Err()
+	if err != nil && atomic.LoadInt32(&timedOut) == 0 {
+		return events, err
+	}
+	return events, nil
+}
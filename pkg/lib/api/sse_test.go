@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	go_test_utils "github.com/programmfabrik/go-test-utils"
+)
+
+func TestReadSSE(t *testing.T) {
+	stream := ": comment\n" +
+		"data: hello\n\n" +
+		"event: update\nid: 1\ndata: {\"a\":\n" +
+		"data: 1}\n\n" +
+		"id: 2\n\n" +
+		"data:plain\n\n"
+	body := ioutil.NopCloser(strings.NewReader(stream))
+
+	events, err := readSSE(body, body, 0, time.Second)
+	go_test_utils.ExpectNoError(t, err, "error reading events")
+
+	eventsJSON, _ := json.Marshal(events)
+	go_test_utils.AssertStringEquals(t,
+		`[{"event":"message","id":"","data":"hello"},{"event":"update","id":"1","data":{"a":1}},{"event":"message","id":"2","data":"plain"}]`,
+		string(eventsJSON))
+
+	body = ioutil.NopCloser(strings.NewReader(stream))
+	events, err = readSSE(body, body, 2, time.Second)
+	go_test_utils.ExpectNoError(t, err, "error reading events")
+	go_test_utils.AssertIntEquals(t, 2, len(events))
+}
+
+func TestSendSSE(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(w, "id: %d\ndata: {\"n\": %d}\n\n", i, i)
+		}
+		w.(http.Flusher).Flush()
+		// The stream stays open
+		<-done
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	tests := []struct {
+		events int
+		count  int
+	}{
+		{2, 2},
+		{5, 3}, // runs into the timeout
+	}
+
+	for _, tc := range tests {
+		request := Request{ServerURL: ts.URL, Method: "GET"}
+		request.ResponseFormat.Type = "sse"
+		request.ResponseFormat.SSE.Events = tc.events
+		request.ResponseFormat.SSE.TimeoutMs = 200
+
+		response, err := request.Send()
+		go_test_utils.ExpectNoError(t, err, "error sending request")
+
+		generic, err := response.ServerResponseToGenericJSON(request.ResponseFormat, true)
+		go_test_utils.ExpectNoError(t, err, "error converting response")
+		events := generic.([]interface{})
+		go_test_utils.AssertIntEquals(t, tc.count, len(events))
+		go_test_utils.AssertStringEquals(t, "1", events[1].(map[string]interface{})["id"].(string))
+	}
+}
@@ -0,0 +1,312 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UploadConfig splits the body file of a request with body type "upload" into
+// chunks. With protocol "content-range" every chunk is sent to the endpoint with a
+// Content-Range header. With "tus" the upload is created at the endpoint and the
+// chunks are sent to its location, see https://tus.io/protocols/resumable-upload
+type UploadConfig struct {
+	Protocol  string `yaml:"protocol" json:"protocol"`     // "content-range" (default) or "tus"
+	ChunkSize string `yaml:"chunk_size" json:"chunk_size"` // like "5MB", default "1MB"
+	// After this number of chunks the upload is interrupted. It resumes at the
+	// offset the server reports, like a client after a lost connection
+	InterruptAfter int `yaml:"interrupt_after" json:"interrupt_after"`
+}
+
+const (
+	defaultUploadChunkSize = 1 << 20
+	tusVersion             = "1.0.0"
+)
+
+// uploader reads the chunks of the body file and sends them
+type uploader struct {
+	request   Request
+	config    UploadConfig
+	chunkSize int64
+	size      int64
+	file      streamBody
+	pos       int64 // read position in file
+}
+
+// sendUpload sends the body file in chunks and returns the last response. A
+// response with an unexpected status ends the upload, so it can be checked
+func (request Request) sendUpload() (response Response, err error) {
+	config := UploadConfig{}
+	if request.Upload != nil {
+		config = *request.Upload
+	}
+	chunkSize := int64(defaultUploadChunkSize)
+	if config.ChunkSize != "" {
+		chunkSize, err = parseSize(config.ChunkSize)
+		if err != nil {
+			return response, fmt.Errorf("invalid upload chunk_size '%s': %s", config.ChunkSize, err)
+		}
+		if chunkSize == 0 {
+			return response, fmt.Errorf("upload chunk_size must not be 0")
+		}
+	}
+	if request.BodyFile == "" {
+		return response, fmt.Errorf(`Missing "body_file" for upload`)
+	}
+
+	file, err := openBodyFile(request.BodyFile, request.ManifestDir)
+	if err != nil {
+		return response, fmt.Errorf("Could not open upload file: %s", err)
+	}
+	u := &uploader{
+		request:   request,
+		config:    config,
+		chunkSize: chunkSize,
+		size:      file.size,
+		file:      file,
+	}
+	defer func() {
+		u.file.Close()
+	}()
+	if u.size < 0 {
+		return response, fmt.Errorf("upload needs a file of known size: %s", request.BodyFile)
+	}
+
+	start := time.Now()
+	switch config.Protocol {
+	case "", "content-range":
+		response, err = u.contentRange()
+	case "tus":
+		response, err = u.tus()
+	default:
+		return response, fmt.Errorf("unknown upload protocol '%s'", config.Protocol)
+	}
+	if err != nil {
+		return response, err
+	}
+	response.duration = time.Since(start)
+	return response, nil
+}
+
+// contentRange sends the chunks with the method of the request, PUT by default.
+// The server answers 308 or 2xx to continue, with an optional Range header of the
+// received bytes. To resume, an empty request with "Content-Range: bytes */<size>"
+// asks for the Range. A chunk after which the offset does not increase is an error
+func (u *uploader) contentRange() (response Response, err error) {
+	method := u.request.Method
+	if method == "" {
+		method = "PUT"
+	}
+	if u.size == 0 {
+		return u.send(method, "", map[string]string{"Content-Range": "bytes */0"}, nil)
+	}
+
+	var offset int64
+	for sent := 0; ; sent++ {
+		if sent > 0 && sent == u.config.InterruptAfter {
+			response, err = u.send(method, "", map[string]string{"Content-Range": fmt.Sprintf("bytes */%d", u.size)}, nil)
+			if err != nil || response.statusCode != http.StatusPermanentRedirect {
+				return response, err
+			}
+			offset, err = rangeOffset(response)
+			if err != nil {
+				return response, err
+			}
+		}
+
+		chunk, err := u.chunk(offset)
+		if err != nil {
+			return response, err
+		}
+		end := offset + int64(len(chunk))
+		headers := map[string]string{
+			"Content-Range": fmt.Sprintf("bytes %d-%d/%d", offset, end-1, u.size),
+			"Content-Type":  "application/octet-stream",
+		}
+		response, err = u.send(method, "", headers, chunk)
+		if err != nil {
+			return response, err
+		}
+		if response.statusCode != http.StatusPermanentRedirect && (response.statusCode < 200 || response.statusCode > 299) {
+			return response, nil
+		}
+
+		start := offset
+		offset = end
+		if response.header("Range") != "" {
+			offset, err = rangeOffset(response)
+			if err != nil {
+				return response, err
+			}
+		}
+		if offset <= start {
+			// The chunk would be sent again and again
+			return response, fmt.Errorf("upload offset did not increase after sending bytes %d-%d", start, end-1)
+		}
+		if offset == u.size {
+			// The last chunk is answered with the final response
+			return response, nil
+		}
+	}
+}
+
+// tus creates the upload with a POST to the endpoint and sends the chunks with
+// PATCH to its location. To resume, a HEAD request asks for the Upload-Offset
+func (u *uploader) tus() (response Response, err error) {
+	headers := map[string]string{
+		"Tus-Resumable": tusVersion,
+		"Upload-Length": strconv.FormatInt(u.size, 10),
+	}
+	response, err = u.send("POST", "", headers, nil)
+	if err != nil || response.statusCode != http.StatusCreated {
+		return response, err
+	}
+	location, err := u.location(response.header("Location"))
+	if err != nil {
+		return response, err
+	}
+
+	var offset int64
+	for sent := 0; offset < u.size; sent++ {
+		if sent > 0 && sent == u.config.InterruptAfter {
+			response, err = u.send("HEAD", location, map[string]string{"Tus-Resumable": tusVersion}, nil)
+			if err != nil || response.statusCode != http.StatusOK {
+				return response, err
+			}
+			offset, err = tusOffset(response)
+			if err != nil {
+				return response, err
+			}
+			if offset >= u.size {
+				break
+			}
+		}
+
+		chunk, err := u.chunk(offset)
+		if err != nil {
+			return response, err
+		}
+		headers := map[string]string{
+			"Tus-Resumable": tusVersion,
+			"Upload-Offset": strconv.FormatInt(offset, 10),
+			"Content-Type":  "application/offset+octet-stream",
+		}
+		response, err = u.send("PATCH", location, headers, chunk)
+		if err != nil || response.statusCode != http.StatusNoContent {
+			return response, err
+		}
+		start := offset
+		offset, err = tusOffset(response)
+		if err != nil {
+			return response, err
+		}
+		if offset <= start {
+			return response, fmt.Errorf("upload offset did not increase after sending %d bytes at offset %d", len(chunk), start)
+		}
+	}
+	return response, nil
+}
+
+// send sends a request of the upload. The request is sent to the endpoint, or to
+// the given location
+func (u *uploader) send(method, location string, headers map[string]string, body []byte) (response Response, err error) {
+	request := u.request
+	request.Method = method
+	if location != "" {
+		request.ServerURL = location
+		request.Endpoint = ""
+		request.QueryParams = nil
+		request.QueryParamsFromStore = nil
+	}
+	request.buildPolicy = func(Request) (map[string]string, io.Reader, error) {
+		return headers, bytes.NewReader(body), nil
+	}
+
+	httpRequest, err := request.buildHttpRequest()
+	if err != nil {
+		return response, fmt.Errorf("Could not buildHttpRequest: %s", err)
+	}
+	return request.do(httpRequest)
+}
+
+// location resolves the location of a created upload against the endpoint
+func (u *uploader) location(location string) (string, error) {
+	if location == "" {
+		return "", fmt.Errorf("tus upload was created without a Location header")
+	}
+	base, err := url.Parse(u.request.url())
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(location)
+	if err != nil {
+		return "", fmt.Errorf("invalid Location '%s': %s", location, err)
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// chunk reads the chunk at the offset. The file is opened again, if the offset is
+// before the read position
+func (u *uploader) chunk(offset int64) ([]byte, error) {
+	if offset > u.size {
+		return nil, fmt.Errorf("upload offset %d is beyond the file size %d", offset, u.size)
+	}
+	if offset < u.pos {
+		u.file.Close()
+		file, err := openBodyFile(u.request.BodyFile, u.request.ManifestDir)
+		if err != nil {
+			return nil, fmt.Errorf("Could not open upload file: %s", err)
+		}
+		u.file = file
+		u.pos = 0
+	}
+	if offset > u.pos {
+		n, err := io.CopyN(ioutil.Discard, u.file, offset-u.pos)
+		u.pos += n
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	n := u.chunkSize
+	if u.size-offset < n {
+		n = u.size - offset
+	}
+	chunk := make([]byte, n)
+	read, err := io.ReadFull(u.file, chunk)
+	u.pos += int64(read)
+	return chunk, err
+}
+
+// rangeOffset returns the offset after the received bytes, from a Range header
+// like "bytes=0-1023". Without the header nothing was received
+func rangeOffset(response Response) (int64, error) {
+	rng := response.header("Range")
+	if rng == "" {
+		return 0, nil
+	}
+	idx := strings.LastIndex(rng, "-")
+	if !strings.HasPrefix(rng, "bytes=0-") || idx < 0 {
+		return 0, fmt.Errorf("invalid Range header '%s'", rng)
+	}
+	last, err := strconv.ParseInt(rng[idx+1:], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid Range header '%s'", rng)
+	}
+	return last + 1, nil
+}
+
+// tusOffset returns the Upload-Offset of the response
+func tusOffset(response Response) (int64, error) {
+	offset, err := strconv.ParseInt(response.header("Upload-Offset"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid Upload-Offset header '%s'", response.header("Upload-Offset"))
+	}
+	return offset, nil
+}
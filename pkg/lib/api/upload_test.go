@@ -0,0 +1,154 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/programmfabrik/apitest/pkg/lib/filesystem"
+	go_test_utils "github.com/programmfabrik/go-test-utils"
+	"github.com/spf13/afero"
+)
+
+// uploadServer receives uploads. When asked for the received bytes, it forgets
+// the last chunk, so the client has to send it again
+type uploadServer struct {
+	data      []byte
+	lastChunk int
+	requests  []string
+}
+
+func (s *uploadServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	body, _ := ioutil.ReadAll(r.Body)
+
+	switch r.URL.Path {
+	case "/content-range":
+		var start, end, size int
+		if _, err := fmt.Sscanf(r.Header.Get("Content-Range"), "bytes */%d", &size); err == nil {
+			s.data = s.data[:len(s.data)-s.lastChunk]
+		} else {
+			fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &size)
+			if start != len(s.data) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			s.data = append(s.data, body...)
+			s.lastChunk = len(body)
+		}
+		if len(s.data) == size {
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"size": %d}`, size)
+			return
+		}
+		if len(s.data) > 0 {
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(s.data)-1))
+		}
+		w.WriteHeader(http.StatusPermanentRedirect)
+	case "/files":
+		w.Header().Set("Location", "/files/1")
+		w.WriteHeader(http.StatusCreated)
+	case "/files/1":
+		switch r.Method {
+		case "HEAD":
+			s.data = s.data[:len(s.data)-s.lastChunk]
+		case "PATCH":
+			if r.Header.Get("Upload-Offset") != strconv.Itoa(len(s.data)) || r.Header.Get("Tus-Resumable") != tusVersion {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			s.data = append(s.data, body...)
+			s.lastChunk = len(body)
+		}
+		w.Header().Set("Upload-Offset", strconv.Itoa(len(s.data)))
+		if r.Method == "PATCH" {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+func TestSendUpload(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	filesystem.Fs = afero.NewMemMapFs()
+	afero.WriteFile(filesystem.Fs, "test/file.bin", content, 0644)
+
+	tests := []struct {
+		endpoint       string
+		protocol       string
+		interruptAfter int
+		status         int
+		requests       int
+	}{
+		{"content-range", "", 0, http.StatusCreated, 4},
+		{"content-range", "content-range", 2, http.StatusCreated, 6},
+		{"files", "tus", 0, http.StatusNoContent, 5},
+		{"files", "tus", 3, http.StatusNoContent, 7},
+	}
+
+	for _, tc := range tests {
+		server := &uploadServer{}
+		ts := httptest.NewServer(server)
+
+		request := Request{
+			ServerURL:   ts.URL,
+			Endpoint:    tc.endpoint,
+			BodyType:    "upload",
+			BodyFile:    "@file.bin",
+			ManifestDir: "test/",
+			Upload: &UploadConfig{
+				Protocol:       tc.protocol,
+				ChunkSize:      "300B",
+				InterruptAfter: tc.interruptAfter,
+			},
+		}
+		response, err := request.Send()
+		ts.Close()
+		go_test_utils.ExpectNoError(t, err, "error sending upload to "+tc.endpoint)
+
+		go_test_utils.AssertIntEquals(t, tc.status, response.StatusCode())
+		go_test_utils.AssertIntEquals(t, tc.requests, len(server.requests))
+		if !bytes.Equal(content, server.data) {
+			t.Errorf("%s: uploaded %d bytes, expected %d", tc.endpoint, len(server.data), len(content))
+		}
+	}
+
+	// An unexpected status ends the upload and is returned
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer ts.Close()
+	request := Request{ServerURL: ts.URL, BodyType: "upload", BodyFile: "@file.bin", ManifestDir: "test/"}
+	response, err := request.Send()
+	go_test_utils.ExpectNoError(t, err, "error sending upload")
+	go_test_utils.AssertIntEquals(t, http.StatusForbidden, response.StatusCode())
+
+	// A server that never accepts a chunk must not be sent the same chunk forever
+	stuck := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/files":
+			w.Header().Set("Location", "/files/1")
+			w.WriteHeader(http.StatusCreated)
+		case "/files/1":
+			w.Header().Set("Upload-Offset", "0")
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Range", "bytes=0-99")
+			w.WriteHeader(http.StatusPermanentRedirect)
+		}
+	}))
+	defer stuck.Close()
+	for protocol, endpoint := range map[string]string{"content-range": "content-range", "tus": "files"} {
+		stuckRequest := Request{ServerURL: stuck.URL, Endpoint: endpoint, BodyType: "upload", BodyFile: "@file.bin", ManifestDir: "test/",
+			Upload: &UploadConfig{Protocol: protocol, ChunkSize: "300B"}}
+		_, err = stuckRequest.Send()
+		go_test_utils.ExpectError(t, err, "expected error for an offset that does not increase with "+protocol)
+	}
+
+	request.Upload = &UploadConfig{Protocol: "unknown"}
+	_, err = request.Send()
+	go_test_utils.ExpectError(t, err, "expected error for unknown protocol")
+}
@@ -58,6 +58,17 @@ func getIndepthJsonError(input []byte, inputError error) (err error) {
 			getErrorJsonWithLineNumbers(string(input), line), jsonError.Value, jsonError.Type.Name(), jsonError.Struct, jsonError.Field, line, character)
 	}
 
+	// The decoder does not tell where an unknown field is, so the first key with that name is shown
+	if strings.HasPrefix(inputError.Error(), "json: unknown field ") {
+		field := strings.TrimPrefix(inputError.Error(), "json: unknown field ")
+		line, character, lcErr := lineAndCharacter(string(input), strings.Index(string(input), field+":"))
+		if lcErr != nil {
+			return
+		}
+		return fmt.Errorf(`In JSON '%s', the field %s is unknown. See input file line %d, character %d`,
+			getErrorJsonWithLineNumbers(string(input), line), field, line, character)
+	}
+
 	return
 }
 
@@ -2,6 +2,7 @@ package cjson
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/programmfabrik/apitest/pkg/lib/compare"
@@ -296,3 +297,23 @@ func TestCJSONUnmarshalTypeErr(t *testing.T) {
 		},
 	)
 }
+
+func TestCJSONUnmarshalUnknownFieldErr(t *testing.T) {
+	cjsonString := `{
+	"name": "a",
+	"nmae": "b"
+}`
+
+	type expectedStructure struct {
+		Name string `json:"name"`
+	}
+
+	var oObject expectedStructure
+	oErr := Unmarshal([]byte(cjsonString), &oObject)
+	if oErr == nil {
+		t.Fatal("Expected an error for the unknown field")
+	}
+	if !strings.Contains(oErr.Error(), `the field "nmae" is unknown. See input file line 3, character 1`) {
+		t.Errorf("Unexpected error: %s", oErr)
+	}
+}
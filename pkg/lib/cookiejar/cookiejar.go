@@ -0,0 +1,45 @@
+// Package cookiejar keeps the named cookie jars of a test suite
+package cookiejar
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sync"
+)
+
+// Jars holds cookie jars by name. Jars are created on first use
+type Jars struct {
+	jars map[string]http.CookieJar
+	lock *sync.Mutex
+}
+
+func NewJars() *Jars {
+	return &Jars{
+		jars: map[string]http.CookieJar{},
+		lock: &sync.Mutex{},
+	}
+}
+
+// Get returns the jar with the given name
+func (j *Jars) Get(name string) http.CookieJar {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	jar, ok := j.jars[name]
+	if !ok {
+		// cookiejar.New only fails for invalid options
+		jar, _ = cookiejar.New(nil)
+		j.jars[name] = jar
+	}
+	return jar
+}
+
+// Cookies returns name and value of all cookies in the jar that would be sent to u
+func (j *Jars) Cookies(name string, u *url.URL) map[string]string {
+	cookies := map[string]string{}
+	for _, c := range j.Get(name).Cookies(u) {
+		cookies[c.Name] = c.Value
+	}
+	return cookies
+}
@@ -0,0 +1,25 @@
+package cookiejar
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	go_test_utils "github.com/programmfabrik/go-test-utils"
+)
+
+func TestJars(t *testing.T) {
+	jars := NewJars()
+	u, _ := url.Parse("http://localhost/api")
+
+	jars.Get("admin").SetCookies(u, []*http.Cookie{{Name: "sess", Value: "admin-session"}})
+	jars.Get("user").SetCookies(u, []*http.Cookie{{Name: "sess", Value: "user-session"}})
+
+	go_test_utils.AssertStringEquals(t, "admin-session", jars.Cookies("admin", u)["sess"])
+	go_test_utils.AssertStringEquals(t, "user-session", jars.Cookies("user", u)["sess"])
+	go_test_utils.AssertIntEquals(t, 0, len(jars.Cookies("other", u)))
+
+	if jars.Get("admin") != jars.Get("admin") {
+		t.Error("Expected the same jar for the same name")
+	}
+}
@@ -92,6 +92,19 @@ func (ds *Datastore) AppendResponse(s string) {
 	ds.responseJson = append(ds.responseJson, s)
 }
 
+// ResponseCount returns the number of stored responses
+func (ds *Datastore) ResponseCount() int {
+	return len(ds.responseJson)
+}
+
+// TruncateResponses removes all responses after the first n, like the responses
+// of a failed attempt that is retried
+func (ds *Datastore) TruncateResponses(n int) {
+	if n < len(ds.responseJson) {
+		ds.responseJson = ds.responseJson[:n]
+	}
+}
+
 func (ds *Datastore) SetMap(smap map[string]interface{}) error {
 	for k, v := range smap {
 		err := ds.Set(k, v)
@@ -14,6 +14,7 @@ type XMLRoot struct {
 	Id         string      `xml:"id,attr"`
 	Name       string      `xml:"name,attr"`
 	Failures   int         `xml:"failures,attr"`
+	Skipped    int         `xml:"skipped,attr"`
 	Time       float64     `xml:"time,attr"`
 	Tests      int         `xml:"tests,attr"`
 	Testsuites []testsuite `xml:"testsuite"`
@@ -24,6 +25,7 @@ type testsuite struct {
 	Name      string     `xml:"name,attr"`
 	Tests     int        `xml:"tests,attr"`
 	Failures  int        `xml:"failures,attr"`
+	Skipped   int        `xml:"skipped,attr"`
 	Time      float64    `xml:"time,attr"`
 	Testcases []testcase `xml:"testcase"`
 	Failure   *failure   `xml:"failure,omitempty"`
@@ -34,6 +36,7 @@ type testcase struct {
 	Name    string   `xml:"name,attr"`
 	Time    float64  `xml:"time,attr"`
 	Failure *failure `xml:"failure,omitempty"`
+	Skipped *skipped `xml:"skipped,omitempty"`
 }
 
 type failure struct {
@@ -41,6 +44,10 @@ type failure struct {
 	Type    string `xml:"type,attr"`
 }
 
+type skipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
 type JUnitReporter struct {
 	report Report
 }
@@ -60,6 +67,7 @@ func ParseJUnitResult(baseResult *ReportElement) []byte {
 		Name:     testName,
 		Id:       testName,
 		Failures: baseResult.Failures,
+		Skipped:  baseResult.Skipped,
 		Tests:    baseResult.TestCount,
 		Time:     baseResult.ExecutionTime.Seconds(),
 	}
@@ -69,6 +77,7 @@ func ParseJUnitResult(baseResult *ReportElement) []byte {
 			Id:       strconv.Itoa(k),
 			Time:     v.ExecutionTime.Seconds(),
 			Failures: v.Failures,
+			Skipped:  v.Skipped,
 			Tests:    v.TestCount,
 			Name:     strings.Replace(v.Name, ".", ":", -1),
 		}
@@ -106,6 +115,10 @@ func ParseJUnitResult(baseResult *ReportElement) []byte {
 				}
 			}
 
+			if iv.SkipReason != "" {
+				newTestCase.Skipped = &skipped{Message: iv.SkipReason}
+			}
+
 			newTestSuite.Testcases = append(newTestSuite.Testcases, newTestCase)
 		}
 		result.Testsuites = append(result.Testsuites, newTestSuite)
@@ -54,9 +54,22 @@ func (r Report) GetLog() []string {
 	return r.root.GetLog()
 }
 
+const (
+	StatusSuccess = "success"
+	StatusFailure = "failure"
+	StatusSkipped = "skipped"
+	// StatusFlakyPassed is a success that needed more than one attempt
+	StatusFlakyPassed = "flaky_passed"
+)
+
 type ReportElement struct {
 	Failures      int            `json:"failures"`
 	TestCount     int            `json:"test_count,omitempty"`
+	Skipped       int            `json:"skipped,omitempty"`
+	Flaky         int            `json:"flaky,omitempty"`
+	Attempts      int            `json:"attempts,omitempty"`
+	SkipReason    string         `json:"skip_reason,omitempty"`
+	Status        string         `json:"status,omitempty"`
 	ExecutionTime time.Duration  `json:"execution_time_ns"`
 	StartTime     time.Time      `json:"-"`
 	Name          string         `json:"name,omitempty"`
@@ -65,6 +78,7 @@ type ReportElement struct {
 	Parent        *ReportElement `json:"-"`
 	NoLogTime     bool           `json:"-"`
 	Failure       string         `json:"failure,omitempty"`
+	Load          *LoadResult    `json:"load,omitempty"`
 	report        *Report
 	m             *sync.Mutex
 }
@@ -118,25 +132,94 @@ func (r *ReportElement) Leave(result bool) {
 
 	if len(r.SubTests) == 0 {
 		r.TestCount++
-		if !result {
+		if r.SkipReason != "" {
+			r.Skipped++
+		} else if !result {
 			r.Failures++
+		} else if r.Attempts > 1 {
+			r.Flaky++
 		}
 	}
+
+	switch {
+	case r.SkipReason != "":
+		r.Status = StatusSkipped
+	case result && r.Attempts > 1:
+		r.Status = StatusFlakyPassed
+	case result:
+		r.Status = StatusSuccess
+	default:
+		r.Status = StatusFailure
+	}
+
 	r.ExecutionTime = time.Since(r.StartTime)
 }
 
+// Skip marks the element as not run. It is counted as skipped once it is left
+func (r *ReportElement) Skip(reason string) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.SkipReason = reason
+}
+
+// LoadResult is the outcome of a test with a load block. Errors are requests
+// that could not be sent, Failed are responses that did not match
+type LoadResult struct {
+	Requests          int     `json:"requests"`
+	Errors            int     `json:"errors"`
+	Failed            int     `json:"failed"`
+	ErrorRate         float64 `json:"error_rate"`
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	P50Ms             float64 `json:"p50_ms"`
+	P90Ms             float64 `json:"p90_ms"`
+	P99Ms             float64 `json:"p99_ms"`
+	MaxMs             float64 `json:"max_ms"`
+}
+
+// SetLoadResult adds the outcome of a load test to the element
+func (r *ReportElement) SetLoadResult(result *LoadResult) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.Load = result
+}
+
+// SetAttempts records how often the test was run. A success after more
+// than one attempt is reported as flaky passed
+func (r *ReportElement) SetAttempts(attempts int) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.Attempts = attempts
+}
+
 //aggregate results of subtests
 func (r *ReportElement) getTestResult() *ReportElement {
 	for _, v := range r.SubTests {
 		subResults := v.getTestResult()
 		r.TestCount += subResults.TestCount
 		r.Failures += subResults.Failures
+		r.Skipped += subResults.Skipped
+		r.Flaky += subResults.Flaky
 	}
 
 	if r.ExecutionTime == 0 {
 		r.ExecutionTime = time.Since(r.StartTime)
 	}
 
+	// Elements that were never left (like the root) get their status from the sub tests
+	if r.Status == "" {
+		switch {
+		case r.Failures > 0:
+			r.Status = StatusFailure
+		case r.TestCount > 0 && r.TestCount == r.Skipped:
+			r.Status = StatusSkipped
+		default:
+			r.Status = StatusSuccess
+		}
+	}
+
 	return r
 }
 
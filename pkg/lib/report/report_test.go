@@ -182,3 +182,66 @@ func TestReportLog(t *testing.T) {
 		}
 	}
 }
+
+func TestReportSkipped(t *testing.T) {
+	r := NewReport()
+	r.Root().NoLogTime = true
+
+	child := r.Root().NewChild("Level 1 - 1")
+	child.NewChild("Level 2 - 1").Leave(true)
+	skipped := child.NewChild("Level 2 - 2")
+	skipped.Skip("no tag is in --tags")
+	skipped.Leave(true)
+	child.Leave(true)
+
+	var realJ ReportElement
+	cjson.Unmarshal(r.GetTestResult(ParseJSONResult), &realJ)
+	if realJ.TestCount != 2 || realJ.Skipped != 1 || realJ.Failures != 0 {
+		t.Errorf("Expected 2 tests, 1 skipped, 0 failures. Got %d, %d, %d", realJ.TestCount, realJ.Skipped, realJ.Failures)
+	}
+
+	if realJ.Status != StatusSuccess || realJ.SubTests[0].SubTests[1].Status != StatusSkipped {
+		t.Errorf("Expected status success for root and skipped for the skipped test. Got %s, %s", realJ.Status, realJ.SubTests[0].SubTests[1].Status)
+	}
+
+	var realX XMLRoot
+	xml.Unmarshal(ParseJUnitResult(r.Root()), &realX)
+	if realX.Testsuites[0].Skipped != 1 {
+		t.Errorf("Expected 1 skipped test in testsuite, got %d", realX.Testsuites[0].Skipped)
+	}
+	if realX.Testsuites[0].Testcases[0].Skipped != nil {
+		t.Error("Expected first testcase not to be skipped")
+	}
+	if realX.Testsuites[0].Testcases[1].Skipped == nil || realX.Testsuites[0].Testcases[1].Skipped.Message != "no tag is in --tags" {
+		t.Error("Expected second testcase to be skipped with reason")
+	}
+}
+
+func TestReportFlaky(t *testing.T) {
+	r := NewReport()
+	r.Root().NoLogTime = true
+
+	child := r.Root().NewChild("Level 1 - 1")
+	child.NewChild("Level 2 - 1").Leave(true)
+	flaky := child.NewChild("Level 2 - 2")
+	flaky.SetAttempts(3)
+	flaky.Leave(true)
+	failed := child.NewChild("Level 2 - 3")
+	failed.SetAttempts(3)
+	failed.Leave(false)
+	child.Leave(false)
+
+	var realJ ReportElement
+	cjson.Unmarshal(r.GetTestResult(ParseJSONResult), &realJ)
+	if realJ.TestCount != 3 || realJ.Flaky != 1 || realJ.Failures != 1 {
+		t.Errorf("Expected 3 tests, 1 flaky, 1 failure. Got %d, %d, %d", realJ.TestCount, realJ.Flaky, realJ.Failures)
+	}
+
+	tests := realJ.SubTests[0].SubTests
+	if tests[0].Status != StatusSuccess || tests[1].Status != StatusFlakyPassed || tests[2].Status != StatusFailure {
+		t.Errorf("Expected status success, flaky_passed, failure. Got %s, %s, %s", tests[0].Status, tests[1].Status, tests[2].Status)
+	}
+	if tests[1].Attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", tests[1].Attempts)
+	}
+}
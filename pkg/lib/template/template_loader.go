@@ -9,12 +9,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"os"
+	"path"
 	"reflect"
 	"regexp"
 	"strings"
 	"text/template"
 
 	"github.com/pkg/errors"
+	"github.com/programmfabrik/apitest/pkg/lib/cookiejar"
 	"github.com/programmfabrik/apitest/pkg/lib/datastore"
 
 	"github.com/programmfabrik/apitest/pkg/lib/cjson"
@@ -76,8 +79,16 @@ type Loader struct {
 	HTTPServerHost string
 	ServerURL      *url.URL
 	OAuthClient    util.OAuthClientsConfig
+	CookieJars     *cookiejar.Jars
+
+	// StubDatastore is used when nothing was run and stored yet (--dry-run):
+	// missing datastore values are null, and so are qjson queries on them
+	StubDatastore bool
 }
 
+// datastoreStub is returned for missing datastore values if StubDatastore is set
+const datastoreStub = "null"
+
 func NewLoader(datastore *datastore.Datastore) Loader {
 	return Loader{datastore: datastore}
 }
@@ -96,6 +107,9 @@ func (loader *Loader) Render(
 
 	funcMap = template.FuncMap{
 		"qjson": func(path string, json string) (result string, err error) {
+			if loader.StubDatastore && json == datastoreStub {
+				return datastoreStub, nil
+			}
 			if json == "" {
 				err = fmt.Errorf("The given json was empty")
 				return
@@ -240,7 +254,11 @@ func (loader *Loader) Render(
 				return "", fmt.Errorf("datastore needs string, int, or int64 as parameter")
 			}
 
-			return loader.datastore.Get(key)
+			res, err := loader.datastore.Get(key)
+			if loader.StubDatastore && (err != nil || res == "") {
+				return datastoreStub, nil
+			}
+			return res, err
 		},
 		"unmarshal": func(s string) (interface{}, error) {
 			var gj interface{}
@@ -355,6 +373,31 @@ func (loader *Loader) Render(
 		"server_url": func() url.URL {
 			return *loader.ServerURL
 		},
+		"cookie_jar": func(name string, endpoint ...string) (map[string]string, error) {
+			if loader.CookieJars == nil {
+				return nil, errors.Errorf("no cookie jars available")
+			}
+			u := url.URL{}
+			if loader.ServerURL != nil {
+				u = *loader.ServerURL
+			}
+			if len(endpoint) > 0 {
+				// Absolute urls are used as they are, others are relative to the server url
+				parsedURL, err := url.Parse(endpoint[0])
+				if err != nil {
+					return nil, err
+				}
+				if parsedURL.IsAbs() {
+					u = *parsedURL
+				} else {
+					u.Path = path.Join("/", u.Path, parsedURL.Path)
+				}
+			}
+			return loader.CookieJars.Cookies(name, &u), nil
+		},
+		"env": func(name string) string {
+			return os.Getenv(name)
+		},
 		"is_zero": func(v interface{}) bool {
 			if v == nil {
 				return true
@@ -444,6 +487,16 @@ func (loader *Loader) Render(
 	return buf.Bytes(), nil
 }
 
+// Condition renders the template pipeline expr (without {{ }}) and tells if it
+// is true, following the rules of the template "if" action
+func (loader *Loader) Condition(expr, rootDir string) (bool, error) {
+	res, err := loader.Render([]byte("{{ if "+expr+" }}true{{ end }}"), rootDir, nil)
+	if err != nil {
+		return false, err
+	}
+	return string(res) == "true", nil
+}
+
 func getRowsFromInput(rowsInput interface{}) []map[string]interface{} {
 	rows := make([]map[string]interface{}, 0)
 	switch t := rowsInput.(type) {
@@ -2,6 +2,7 @@ package template
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -451,3 +452,50 @@ func Test_DataStore_QJson(t *testing.T) {
 	}
 
 }
+
+func TestCondition(t *testing.T) {
+	store := datastore.NewStore(false)
+	store.Set("feature", "off")
+	os.Setenv("APITEST_CONDITION", "set")
+	loader := NewLoader(store)
+
+	tests := map[string]bool{
+		`eq (datastore "feature") "off"`: true,
+		`eq (datastore "feature") "on"`:  false,
+		`datastore "missing"`:            false,
+		`env "APITEST_CONDITION"`:        true,
+		`not (env "APITEST_MISSING")`:    true,
+	}
+	for expr, exp := range tests {
+		res, err := loader.Condition(expr, "")
+		go_test_utils.ExpectNoError(t, err, fmt.Sprintf("error evaluating '%s'", expr))
+		if res != exp {
+			t.Errorf("'%s': expected %v, got %v", expr, exp, res)
+		}
+	}
+
+	_, err := loader.Condition(`eq (`, "")
+	go_test_utils.ExpectError(t, err, "expected error for invalid expression")
+}
+
+func TestStubDatastore(t *testing.T) {
+	store := datastore.NewStore(false)
+	store.Set("set", "value")
+	loader := NewLoader(store)
+
+	_, err := loader.Render([]byte(`{{ datastore -1 | qjson "body.id" }}`), "", nil)
+	go_test_utils.ExpectError(t, err, "expected error for missing response")
+
+	loader.StubDatastore = true
+	tests := map[string]string{
+		`{{ datastore "set" }}`:                "value",
+		`{{ datastore "missing" }}`:            "null",
+		`{{ datastore -1 }}`:                   "null",
+		`{{ datastore -1 | qjson "body.id" }}`: "null",
+	}
+	for tmpl, exp := range tests {
+		res, err := loader.Render([]byte(tmpl), "", nil)
+		go_test_utils.ExpectNoError(t, err, fmt.Sprintf("error rendering '%s'", tmpl))
+		go_test_utils.AssertStringEquals(t, exp, string(res))
+	}
+}
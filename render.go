@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/programmfabrik/apitest/pkg/lib/cjson"
+	"github.com/programmfabrik/apitest/pkg/lib/datastore"
+	"github.com/programmfabrik/apitest/pkg/lib/filesystem"
+	"github.com/programmfabrik/apitest/pkg/lib/report"
+	"github.com/programmfabrik/apitest/pkg/lib/template"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+)
+
+var (
+	renderCase      int
+	renderStoreFile string
+	renderCurl      bool
+)
+
+func init() {
+	renderCMD.Flags().IntVar(
+		&renderCase, "case", -1,
+		"Only render the n-th test of the manifest (counting from 0, tests in external files included)")
+	renderCMD.Flags().StringVar(
+		&renderStoreFile, "store", "",
+		"JSON file with an object of values to put into the datastore before rendering")
+	renderCMD.Flags().BoolVar(
+		&renderCurl, "curl", false,
+		"Add the curl command for every request")
+
+	testCMD.AddCommand(renderCMD)
+}
+
+var renderCMD = &cobra.Command{
+	Args:  cobra.ExactArgs(1),
+	Use:   "render <manifest>",
+	Short: "Print the rendered tests of a manifest",
+	Long:  "Print requests and expected responses of the tests in a manifest after all templates are rendered, without sending anything",
+	Run:   runRender,
+}
+
+// renderedCase is the output of the render command for a single test
+type renderedCase struct {
+	Index     int                    `json:"index"`
+	Name      string                 `json:"name"`
+	File      string                 `json:"file"`
+	Request   interface{}            `json:"request,omitempty"`
+	WebSocket interface{}            `json:"websocket,omitempty"`
+	Responses map[string]interface{} `json:"responses,omitempty"`
+	Curl      string                 `json:"curl,omitempty"`
+}
+
+func runRender(cmd *cobra.Command, args []string) {
+	store := datastore.NewStore(logDatastore)
+	for k, v := range Config.Apitest.StoreInit {
+		err := store.Set(k, v)
+		if err != nil {
+			logrus.Fatalf("Could not add init value for datastore Key: '%s', Value: '%v'. %s", k, v, err)
+		}
+	}
+	if renderStoreFile != "" {
+		err := loadStoreFile(store, renderStoreFile)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+	}
+
+	manifestPath, _ := filepath.Abs(args[0])
+	// Errors are logged, the tests that could be rendered are still printed
+	cases, errCount, err := renderManifest(manifestPath, store, renderCase, renderCurl)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	var out interface{} = cases
+	if renderCase >= 0 {
+		if len(cases) == 0 {
+			logrus.Fatalf("Test %d not found in '%s'", renderCase, args[0])
+		}
+		out = cases[0]
+	}
+	outBytes, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	fmt.Println(string(outBytes))
+
+	if errCount > 0 && renderCase < 0 {
+		os.Exit(1)
+	}
+}
+
+// loadStoreFile puts all values of the json object in the file into the store
+func loadStoreFile(store *datastore.Datastore, path string) error {
+	data, err := afero.ReadFile(filesystem.Fs, path)
+	if err != nil {
+		return fmt.Errorf("could not read store file '%s': %s", path, err)
+	}
+	values := map[string]interface{}{}
+	err = cjson.Unmarshal(data, &values)
+	if err != nil {
+		return fmt.Errorf("could not parse store file '%s': %s", path, err)
+	}
+	return store.SetMap(values)
+}
+
+// renderManifest renders the tests of the manifest, or only the one with the
+// given index if it is not negative. Missing datastore values are rendered as null.
+// Tests that can not be rendered are logged and counted
+func renderManifest(manifestPath string, store *datastore.Datastore, index int, curl bool) ([]renderedCase, int, error) {
+	config := TestToolConfig{
+		ServerURL:   Config.Apitest.Server,
+		OAuthClient: Config.Apitest.OAuthClient,
+		DryRun:      true,
+	}
+	suite, err := NewTestSuite(config, manifestPath, report.NewReport().Root(), store, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	cases := []renderedCase{}
+	dr := dryRunner{suite: suite}
+	dr.visit = func(test Case, _ []byte, testFilePath string) {
+		if index >= 0 && dr.cases-1 != index {
+			return
+		}
+
+		var err error
+		rc := renderedCase{
+			Index:     dr.cases - 1,
+			Name:      test.Name,
+			File:      testFilePath,
+			Responses: map[string]interface{}{},
+		}
+		if test.RequestData != nil {
+			_, rc.Request, err = template.LoadManifestDataAsObject(*test.RequestData, test.manifestDir, test.loader)
+			if err != nil {
+				dr.fail(testFilePath, fmt.Errorf("'%s': error loading request: %s", test.Name, err))
+				return
+			}
+			if curl {
+				request, err := test.loadRequest()
+				if err != nil {
+					dr.fail(testFilePath, fmt.Errorf("'%s': error loading request: %s", test.Name, err))
+					return
+				}
+				rc.Curl = request.ToString(true)
+			}
+		}
+		if test.WebSocketData != nil {
+			_, rc.WebSocket, err = template.LoadManifestDataAsObject(*test.WebSocketData, test.manifestDir, test.loader)
+			if err != nil {
+				dr.fail(testFilePath, fmt.Errorf("'%s': error loading websocket: %s", test.Name, err))
+				return
+			}
+		}
+		for _, res := range test.responses() {
+			_, rc.Responses[res.key], err = template.LoadManifestDataAsObject(res.data, test.manifestDir, test.loader)
+			if err != nil {
+				dr.fail(testFilePath, fmt.Errorf("'%s': error loading %s: %s", test.Name, res.key, err))
+				return
+			}
+		}
+		cases = append(cases, rc)
+	}
+	for _, v := range suite.Tests {
+		dr.test(v, suite.manifestDir, suite.manifestPath)
+	}
+
+	return cases, len(dr.errors), nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/programmfabrik/apitest/pkg/lib/datastore"
+	"github.com/programmfabrik/apitest/pkg/lib/filesystem"
+	go_test_utils "github.com/programmfabrik/go-test-utils"
+	"github.com/spf13/afero"
+)
+
+func TestRenderManifest(t *testing.T) {
+	filesystem.Fs = afero.NewMemMapFs()
+	afero.WriteFile(filesystem.Fs, "manifest.json", []byte(`{
+		"name": "render",
+		"tests": [
+			"@cases.json",
+			{
+				"name": "stored values",
+				"request": {"endpoint": "{{ datastore "endpoint" }}", "method": "GET"},
+				"response": {"body": {"id": {{ datastore -1 | qjson "body.id" }}}}
+			}
+		]
+	}`), 644)
+	afero.WriteFile(filesystem.Fs, "cases.json", []byte(`["@first.json", "@broken.json"]`), 644)
+	afero.WriteFile(filesystem.Fs, "first.json", []byte(`{"name": "first", "request": {"endpoint": "{{ add 1 2 }}", "method": "GET"}}`), 644)
+	afero.WriteFile(filesystem.Fs, "broken.json", []byte(`{"name": "broken", "request": {"endpoint": "{{ nosuchfunc }}"}}`), 644)
+	afero.WriteFile(filesystem.Fs, "store.json", []byte(`{"endpoint": "stored"}`), 644)
+
+	store := datastore.NewStore(false)
+	err := loadStoreFile(store, "store.json")
+	go_test_utils.ExpectNoError(t, err, "error loading store file")
+
+	cases, errCount, err := renderManifest("manifest.json", store, -1, false)
+	go_test_utils.ExpectNoError(t, err, "error rendering manifest")
+	go_test_utils.AssertIntEquals(t, 1, errCount)
+	go_test_utils.AssertIntEquals(t, 2, len(cases))
+
+	casesJSON, _ := json.Marshal(cases)
+	go_test_utils.AssertStringEquals(t,
+		`[{"index":0,"name":"first","file":"first.json","request":{"endpoint":"3","method":"GET"}},`+
+			`{"index":1,"name":"stored values","file":"manifest.json","request":{"endpoint":"stored","method":"GET"},"responses":{"response":{"body":{"id":null}}}}]`,
+		string(casesJSON))
+
+	cases, _, err = renderManifest("manifest.json", store, 1, false)
+	go_test_utils.ExpectNoError(t, err, "error rendering single test")
+	go_test_utils.AssertIntEquals(t, 1, len(cases))
+	go_test_utils.AssertStringEquals(t, "stored values", cases[0].Name)
+}
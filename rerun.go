@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/programmfabrik/apitest/pkg/lib/cjson"
+	"github.com/programmfabrik/apitest/pkg/lib/filesystem"
+	"github.com/programmfabrik/apitest/pkg/lib/report"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+// failedManifests reads a json report of an earlier run and returns the manifests
+// of the suites that had failures. Failing suites are run as a whole, as their
+// cases usually depend on the datastore filled by the cases before them
+func failedManifests(reportFile string, manifests []string) ([]string, error) {
+	data, err := afero.ReadFile(filesystem.Fs, reportFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read report '%s': %s", reportFile, err)
+	}
+
+	var root report.ReportElement
+	err = cjson.Unmarshal(data, &root)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse json report '%s': %s", reportFile, err)
+	}
+
+	failed := map[string]bool{}
+	for _, suite := range root.SubTests {
+		if suite.Failures == 0 && suite.Status != report.StatusFailure {
+			continue
+		}
+		failed[suite.Name] = true
+		for _, name := range failedCases(suite.SubTests, "") {
+			logrus.Infof("Failed in '%s': %s", suite.Name, name)
+		}
+	}
+
+	// The report names suites by their manifest path with "." replaced
+	rerun := []string{}
+	for _, manifest := range manifests {
+		name := strings.Replace(manifest, ".", "_", -1)
+		if failed[name] {
+			rerun = append(rerun, manifest)
+			delete(failed, name)
+		}
+	}
+	for name := range failed {
+		logrus.Warnf("Failed suite '%s' of the report is not part of this run", name)
+	}
+
+	return rerun, nil
+}
+
+// failedCases returns the paths of all failed leaf elements, like "0/2"
+func failedCases(elems report.ReportElements, prefix string) []string {
+	names := []string{}
+	for _, elem := range elems {
+		name := prefix + elem.Name
+		if len(elem.SubTests) > 0 {
+			names = append(names, failedCases(elem.SubTests, name+"/")...)
+		} else if elem.Failures > 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
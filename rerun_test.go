@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/programmfabrik/apitest/pkg/lib/filesystem"
+	"github.com/programmfabrik/apitest/pkg/lib/report"
+	go_test_utils "github.com/programmfabrik/go-test-utils"
+	"github.com/spf13/afero"
+)
+
+func TestFailedManifests(t *testing.T) {
+	r := report.NewReport()
+
+	ok := r.Root().NewChild("tests/ok/manifest.json")
+	ok.NewChild("login").Leave(true)
+	ok.Leave(true)
+
+	failed := r.Root().NewChild("tests/failed/manifest.json")
+	failed.NewChild("login").Leave(true)
+	failed.NewChild("search").Leave(false)
+	failed.Leave(false)
+
+	broken := r.Root().NewChild("tests/broken/manifest.json")
+	broken.Leave(false)
+
+	removed := r.Root().NewChild("tests/removed/manifest.json")
+	removed.Leave(false)
+
+	filesystem.Fs = afero.NewMemMapFs()
+	afero.WriteFile(filesystem.Fs, "report.json", r.GetTestResult(report.ParseJSONResult), 0644)
+
+	manifests, err := failedManifests("report.json", []string{
+		"tests/broken/manifest.json",
+		"tests/failed/manifest.json",
+		"tests/ok/manifest.json",
+	})
+	go_test_utils.ExpectNoError(t, err, "failedManifests")
+
+	go_test_utils.AssertIntEquals(t, 2, len(manifests))
+	go_test_utils.AssertStringEquals(t, "tests/broken/manifest.json", manifests[0])
+	go_test_utils.AssertStringEquals(t, "tests/failed/manifest.json", manifests[1])
+
+	_, err = failedManifests("missing.json", nil)
+	go_test_utils.ExpectError(t, err, "failedManifests with missing report")
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net"
+	"sync"
+)
+
+// runSuites calls run for every manifest, using up to workers goroutines.
+// With stopOnFail set, no further suites are started after the first failure.
+func runSuites(manifests []string, workers int, stopOnFail bool, run func(idx int, manifest string) bool) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		wg     sync.WaitGroup
+		m      sync.Mutex
+		failed bool
+	)
+
+	// A slot is taken before looking at failed, so with a single worker
+	// the previous suite is always finished before the next one is started
+	slots := make(chan bool, workers)
+	for idx := range manifests {
+		slots <- true
+
+		m.Lock()
+		stop := stopOnFail && failed
+		m.Unlock()
+		if stop {
+			break
+		}
+
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			success := run(idx, manifests[idx])
+
+			m.Lock()
+			if !success {
+				failed = true
+			}
+			m.Unlock()
+
+			<-slots
+		}(idx)
+	}
+	wg.Wait()
+}
+
+// suiteLocks keeps suites from running at the same time when they must not:
+// exclusive suites run alone, and suites whose http_server listens on the
+// same port run one after another
+type suiteLocks struct {
+	exclusive sync.RWMutex
+	m         sync.Mutex
+	ports     map[string]*sync.Mutex
+}
+
+func newSuiteLocks() *suiteLocks {
+	return &suiteLocks{ports: map[string]*sync.Mutex{}}
+}
+
+// lock blocks until the suite is allowed to run. The returned func releases all locks
+func (sl *suiteLocks) lock(suite *Suite) (unlock func()) {
+	if suite.Exclusive {
+		sl.exclusive.Lock()
+	} else {
+		sl.exclusive.RLock()
+	}
+
+	var portLock *sync.Mutex
+	if suite.HttpServer != nil {
+		portLock = sl.portLock(suite.HttpServer.Addr)
+		portLock.Lock()
+	}
+
+	return func() {
+		if portLock != nil {
+			portLock.Unlock()
+		}
+		if suite.Exclusive {
+			sl.exclusive.Unlock()
+		} else {
+			sl.exclusive.RUnlock()
+		}
+	}
+}
+
+func (sl *suiteLocks) portLock(addr string) *sync.Mutex {
+	// ":9999", "localhost:9999" and "0.0.0.0:9999" all bind the same port
+	port := "80"
+	if _, p, err := net.SplitHostPort(addr); err == nil && p != "" {
+		port = p
+	}
+
+	sl.m.Lock()
+	defer sl.m.Unlock()
+
+	l, ok := sl.ports[port]
+	if !ok {
+		l = &sync.Mutex{}
+		sl.ports[port] = l
+	}
+	return l
+}
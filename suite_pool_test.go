@@ -0,0 +1,83 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	go_test_utils "github.com/programmfabrik/go-test-utils"
+)
+
+func TestRunSuitesBoundedWorkers(t *testing.T) {
+	var (
+		m             sync.Mutex
+		running, peak int
+		ran           = map[string]bool{}
+		manifests     = []string{"a", "b", "c", "d", "e", "f"}
+	)
+
+	runSuites(manifests, 3, false, func(idx int, manifest string) bool {
+		m.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		ran[manifest] = true
+		m.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		m.Lock()
+		running--
+		m.Unlock()
+		return true
+	})
+
+	if peak > 3 {
+		t.Errorf("Expected at most 3 suites at a time, got %d", peak)
+	}
+	go_test_utils.AssertIntEquals(t, len(manifests), len(ran))
+}
+
+func TestRunSuitesStopOnFail(t *testing.T) {
+	ran := 0
+	runSuites([]string{"a", "b", "c"}, 1, true, func(idx int, manifest string) bool {
+		ran++
+		return manifest != "a"
+	})
+	go_test_utils.AssertIntEquals(t, 1, ran)
+}
+
+func TestSuiteLocksExclusive(t *testing.T) {
+	locks := newSuiteLocks()
+
+	unlock := locks.lock(&Suite{})
+	done := make(chan bool)
+	go func() {
+		locks.lock(&Suite{Exclusive: true})()
+		done <- true
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Exclusive suite started while another suite was running")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Exclusive suite did not start after the other suite finished")
+	}
+}
+
+func TestSuiteLocksSamePort(t *testing.T) {
+	locks := newSuiteLocks()
+	if locks.portLock(":9999") != locks.portLock("localhost:9999") {
+		t.Error("Expected suites on the same port to share a lock")
+	}
+	if locks.portLock(":9999") == locks.portLock(":9998") {
+		t.Error("Expected suites on different ports to use different locks")
+	}
+}
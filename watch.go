@@ -0,0 +1,194 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/programmfabrik/apitest/pkg/lib/filesystem"
+	"github.com/programmfabrik/apitest/pkg/lib/report"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+// watchDebounce collects the events of editors that write a file in several steps
+const watchDebounce = 200 * time.Millisecond
+
+// recordingFs remembers the local files that are opened through it, like
+// manifests, @ path specs and files loaded by template functions
+type recordingFs struct {
+	afero.Fs
+	m     sync.Mutex
+	files map[string]bool
+}
+
+func (fs *recordingFs) Open(name string) (afero.File, error) {
+	fs.record(name)
+	return fs.Fs.Open(name)
+}
+
+func (fs *recordingFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	fs.record(name)
+	return fs.Fs.OpenFile(name, flag, perm)
+}
+
+func (fs *recordingFs) record(name string) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return
+	}
+
+	fs.m.Lock()
+	defer fs.m.Unlock()
+
+	fs.files[abs] = true
+}
+
+// reset forgets all files recorded so far and returns them
+func (fs *recordingFs) reset() []string {
+	fs.m.Lock()
+	defer fs.m.Unlock()
+
+	files := make([]string, 0, len(fs.files))
+	for f := range fs.files {
+		files = append(files, f)
+	}
+	fs.files = map[string]bool{}
+	return files
+}
+
+// suiteWatcher knows which files every suite loaded during its last run,
+// to re-run only the affected suites once one of them changes
+type suiteWatcher struct {
+	fs        *recordingFs
+	manifests []string
+	files     map[string][]string
+}
+
+// newSuiteWatcher installs a recording filesystem. Suites must run one after
+// another, so the opened files can be told apart
+func newSuiteWatcher() *suiteWatcher {
+	fs := &recordingFs{Fs: filesystem.Fs, files: map[string]bool{}}
+	filesystem.Fs = fs
+
+	return &suiteWatcher{
+		fs:    fs,
+		files: map[string][]string{},
+	}
+}
+
+// runSuite runs a single suite and remembers the files it loaded
+func (sw *suiteWatcher) runSuite(manifest string, run func() bool) bool {
+	sw.fs.reset()
+	success := run()
+
+	// The manifest is watched even if it could not be opened, so fixing it triggers a run
+	abs, _ := filepath.Abs(manifest)
+	files := append(sw.fs.reset(), abs)
+
+	if _, ok := sw.files[manifest]; !ok {
+		sw.manifests = append(sw.manifests, manifest)
+	}
+	sw.files[manifest] = files
+
+	return success
+}
+
+// affected returns the manifests that loaded any of the changed files
+func (sw *suiteWatcher) affected(changed map[string]bool) []string {
+	manifests := []string{}
+	for _, manifest := range sw.manifests {
+		for _, f := range sw.files[manifest] {
+			if changed[f] {
+				manifests = append(manifests, manifest)
+				break
+			}
+		}
+	}
+	return manifests
+}
+
+// watch blocks and calls run with the affected manifests whenever files change
+func (sw *suiteWatcher) watch(run func(manifests []string)) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	// Directories are watched instead of the files, as many editors save by
+	// replacing the file, which ends a watch on the file itself
+	sw.addWatches(w)
+
+	changed := map[string]bool{}
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+
+	for {
+		select {
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if ev.Op == fsnotify.Chmod {
+				continue
+			}
+			changed[filepath.Clean(ev.Name)] = true
+			timer.Reset(watchDebounce)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			return err
+		case <-timer.C:
+			manifests := sw.affected(changed)
+			changed = map[string]bool{}
+			if len(manifests) == 0 {
+				continue
+			}
+
+			logrus.Infof("Files changed, running %d test suites", len(manifests))
+			run(manifests)
+
+			// Suites might load other files now
+			sw.addWatches(w)
+		}
+	}
+}
+
+func (sw *suiteWatcher) addWatches(w *fsnotify.Watcher) {
+	dirs := map[string]bool{}
+	for _, files := range sw.files {
+		for _, f := range files {
+			dirs[filepath.Dir(f)] = true
+		}
+	}
+	for dir := range dirs {
+		err := w.Add(dir)
+		if err != nil {
+			logrus.Warnf("Could not watch '%s': %s", dir, err)
+		}
+	}
+}
+
+// printSummary logs one line for every suite of the report and the failed tests
+func printSummary(rep *report.Report) {
+	failed := 0
+	for _, suite := range rep.Root().SubTests {
+		if suite.Status != report.StatusFailure {
+			logrus.Infof("PASS %s", suite.Name)
+			continue
+		}
+		failed++
+		cases := failedCases(suite.SubTests, "")
+		if len(cases) == 0 {
+			logrus.Errorf("FAIL %s", suite.Name)
+		} else {
+			logrus.Errorf("FAIL %s: %s", suite.Name, strings.Join(cases, ", "))
+		}
+	}
+	logrus.Infof("%d test suites, %d failed", len(rep.Root().SubTests), failed)
+}
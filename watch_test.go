@@ -0,0 +1,49 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/programmfabrik/apitest/pkg/lib/filesystem"
+	go_test_utils "github.com/programmfabrik/go-test-utils"
+	"github.com/spf13/afero"
+)
+
+func TestSuiteWatcherAffected(t *testing.T) {
+	oldFs := filesystem.Fs
+	defer func() { filesystem.Fs = oldFs }()
+
+	filesystem.Fs = afero.NewMemMapFs()
+	afero.WriteFile(filesystem.Fs, "/a/case.json", []byte(`{}`), 0644)
+	afero.WriteFile(filesystem.Fs, "/shared/data.csv", []byte(`a`), 0644)
+
+	sw := newSuiteWatcher()
+
+	sw.runSuite("/a/manifest.json", func() bool {
+		filesystem.Fs.Open("/a/case.json")
+		filesystem.Fs.Open("/shared/data.csv")
+		return true
+	})
+	sw.runSuite("/b/manifest.json", func() bool {
+		filesystem.Fs.Open("/shared/data.csv")
+		return false
+	})
+
+	tests := []struct {
+		changed  string
+		expected []string
+	}{
+		{"/a/case.json", []string{"/a/manifest.json"}},
+		{"/b/manifest.json", []string{"/b/manifest.json"}},
+		{"/shared/data.csv", []string{"/a/manifest.json", "/b/manifest.json"}},
+		{"/shared/other.csv", []string{}},
+	}
+
+	for _, tc := range tests {
+		affected := sw.affected(map[string]bool{filepath.Clean(tc.changed): true})
+		go_test_utils.AssertIntEquals(t, len(tc.expected), len(affected))
+		for i := range tc.expected {
+			go_test_utils.AssertStringEquals(t, tc.expected[i], affected[i])
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/programmfabrik/apitest/pkg/lib/api"
+	"github.com/programmfabrik/apitest/pkg/lib/cjson"
+	"github.com/programmfabrik/apitest/pkg/lib/compare"
+	"github.com/programmfabrik/apitest/pkg/lib/template"
+	"github.com/programmfabrik/apitest/pkg/lib/util"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+)
+
+const defaultWebSocketTimeoutMs = 10000
+
+// CaseWebSocket opens a websocket connection, sends the messages in order and
+// waits for as many messages as are expected
+type CaseWebSocket struct {
+	Endpoint  string            `json:"endpoint"`
+	ServerURL string            `json:"server_url"`
+	Headers   map[string]string `json:"header"`
+	// Strings are sent as they are, everything else as json. All messages are text messages
+	Send []interface{} `json:"send"`
+	// Expected messages, compared like a response body
+	Expect        []interface{}   `json:"expect"`
+	ExpectControl util.JsonObject `json:"expect:control"`
+	// Time to connect, send and receive all messages (default: 10000)
+	TimeoutMs int `json:"timeout_ms"`
+	// TLS settings, like the http block of a request
+	HTTP *api.ClientConfig `json:"http"`
+}
+
+// webSocketResult is the json that is compared and stored for a websocket test
+type webSocketResult struct {
+	Messages        []interface{}   `json:"messages"`
+	MessagesControl util.JsonObject `json:"messages:control,omitempty"`
+}
+
+// runWebSocket runs the websocket block of the test. The received messages can be
+// stored with store_response_qjson, like {"messages": [...]}
+func (testCase Case) runWebSocket() (bool, error) {
+	r := testCase.ReportElem
+
+	ws, err := testCase.loadWebSocket()
+	if err != nil {
+		return false, fmt.Errorf("error loading websocket: %s", err)
+	}
+
+	received, err := testCase.exchangeWebSocket(ws)
+	if err != nil {
+		return false, err
+	}
+
+	receivedJSON, err := json.Marshal(webSocketResult{Messages: received})
+	if err != nil {
+		return false, err
+	}
+	err = testCase.dataStore.SetWithQjson(string(receivedJSON), testCase.StoreResponse)
+	if err != nil {
+		return false, fmt.Errorf("error store response with qjson: %s", err)
+	}
+	testCase.dataStore.AppendResponse(string(receivedJSON))
+
+	expectedJSON, err := json.Marshal(webSocketResult{Messages: ws.Expect, MessagesControl: ws.ExpectControl})
+	if err != nil {
+		return false, err
+	}
+	var expected, got interface{}
+	err = json.Unmarshal(expectedJSON, &expected)
+	if err != nil {
+		return false, err
+	}
+	err = json.Unmarshal(receivedJSON, &got)
+	if err != nil {
+		return false, err
+	}
+
+	responsesMatch, err := compare.JsonEqual(expected, got, compare.ComparisonContext{})
+	if err != nil {
+		return false, fmt.Errorf("error matching websocket messages: %s", err)
+	}
+	if len(received) < len(ws.Expect) {
+		responsesMatch.Equal = false
+		responsesMatch.Failures = append(responsesMatch.Failures, compare.CompareFailure{
+			Key:     "messages",
+			Message: fmt.Sprintf("received %d of %d messages within %dms", len(received), len(ws.Expect), ws.TimeoutMs),
+		})
+	}
+
+	if !responsesMatch.Equal {
+		if !testCase.ReverseTestResult {
+			for _, v := range responsesMatch.Failures {
+				logrus.Errorf("[%s] %s", v.Key, v.Message)
+				r.SaveToReportLog(fmt.Sprintf("[%s] %s", v.Key, v.Message))
+			}
+		}
+		r.SaveToReportLogF("[WEBSOCKET]:\n%s\n\n", limitLines(string(receivedJSON), Config.Apitest.Limit.Response))
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// exchangeWebSocket connects, sends all messages and returns the received ones.
+// Running into the timeout while receiving is no error, fewer messages are returned
+func (testCase Case) exchangeWebSocket(ws CaseWebSocket) ([]interface{}, error) {
+	wsURL, origin, err := webSocketURL(ws.ServerURL, ws.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	config, err := websocket.NewConfig(wsURL, origin)
+	if err != nil {
+		return nil, fmt.Errorf("invalid websocket url '%s': %s", wsURL, err)
+	}
+	for k, v := range ws.Headers {
+		config.Header.Set(k, v)
+	}
+	// The same tls settings as for the http client
+	config.TlsConfig, err = api.Request{HTTP: ws.HTTP, ManifestDir: testCase.manifestDir}.TLSConfig()
+	if err != nil {
+		return nil, fmt.Errorf("could not create tls config: %s", err)
+	}
+	timeout := time.Duration(ws.TimeoutMs) * time.Millisecond
+	config.Dialer = &net.Dialer{Timeout: timeout}
+
+	conn, err := websocket.DialConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to websocket '%s': %s", wsURL, err)
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return nil, err
+	}
+
+	for i, msg := range ws.Send {
+		text, ok := msg.(string)
+		if !ok {
+			textBytes, err := json.Marshal(msg)
+			if err != nil {
+				return nil, fmt.Errorf("could not marshal message %d: %s", i, err)
+			}
+			text = string(textBytes)
+		}
+		if testCase.LogNetwork != nil && *testCase.LogNetwork {
+			logrus.Tracef("[WEBSOCKET SEND]:\n%s\n\n", text)
+		}
+		err = websocket.Message.Send(conn, text)
+		if err != nil {
+			return nil, fmt.Errorf("could not send message %d: %s", i, err)
+		}
+	}
+
+	received := []interface{}{}
+	for len(received) < len(ws.Expect) {
+		var data []byte
+		err = websocket.Message.Receive(conn, &data)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				break
+			}
+			return received, fmt.Errorf("could not receive message %d: %s", len(received), err)
+		}
+		if testCase.LogNetwork != nil && *testCase.LogNetwork {
+			logrus.Debugf("[WEBSOCKET RECEIVE]:\n%s\n\n", data)
+		}
+
+		// Messages that are no json are compared as strings
+		var msg interface{}
+		if json.Unmarshal(data, &msg) != nil {
+			msg = string(data)
+		}
+		received = append(received, msg)
+	}
+
+	return received, nil
+}
+
+// webSocketURL returns the ws:// or wss:// url of the endpoint and the matching
+// http origin
+func webSocketURL(serverURL, endpoint string) (string, string, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid server url '%s': %s", serverURL, err)
+	}
+	origin := *u
+	switch u.Scheme {
+	case "http", "ws":
+		u.Scheme = "ws"
+		origin.Scheme = "http"
+	case "https", "wss":
+		u.Scheme = "wss"
+		origin.Scheme = "https"
+	default:
+		return "", "", fmt.Errorf("unsupported scheme '%s' in server url '%s'", u.Scheme, serverURL)
+	}
+	origin.Path = ""
+	return strings.TrimRight(u.String(), "/") + "/" + strings.TrimLeft(endpoint, "/"), origin.String(), nil
+}
+
+func (testCase Case) loadWebSocket() (CaseWebSocket, error) {
+	var ws CaseWebSocket
+
+	_, wsData, err := template.LoadManifestDataAsObject(*testCase.WebSocketData, testCase.manifestDir, testCase.loader)
+	if err != nil {
+		return ws, fmt.Errorf("error loading websocket data: %s", err)
+	}
+	wsBytes, err := json.Marshal(wsData)
+	if err != nil {
+		return ws, fmt.Errorf("error marshaling websocket: %s", err)
+	}
+	err = cjson.Unmarshal(wsBytes, &ws)
+	if err != nil {
+		return ws, fmt.Errorf("error unmarshaling websocket: %s", err)
+	}
+
+	if ws.ServerURL == "" {
+		ws.ServerURL = testCase.ServerURL
+	}
+	if ws.TimeoutMs <= 0 {
+		ws.TimeoutMs = defaultWebSocketTimeoutMs
+	}
+	return ws, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/programmfabrik/apitest/pkg/lib/datastore"
+	"github.com/programmfabrik/apitest/pkg/lib/filesystem"
+	"github.com/programmfabrik/apitest/pkg/lib/report"
+	"github.com/programmfabrik/apitest/pkg/lib/template"
+	go_test_utils "github.com/programmfabrik/go-test-utils"
+	"github.com/spf13/afero"
+	"golang.org/x/net/websocket"
+)
+
+func TestWebSocket(t *testing.T) {
+	ts := httptest.NewServer(websocket.Server{Handler: wsEcho})
+	defer ts.Close()
+
+	tests := []struct {
+		websocket string
+		success   bool
+	}{
+		{`{"endpoint": "echo", "send": ["hello", {"id": 1}], "expect": ["hello", {"id": 1}]}`, true},
+		{`{"endpoint": "echo", "send": ["hello", {"id": 1}], "expect": [{"id": 1}, "hello"]}`, true},
+		{`{"endpoint": "echo", "send": ["hello", {"id": 1}], "expect": [{"id": 1}, "hello"], "expect:control": {"order_matters": true}}`, false},
+		{`{"endpoint": "echo", "send": ["hello"], "expect": ["hello", "world"], "timeout_ms": 200}`, false},
+	}
+
+	for _, tc := range tests {
+		r := report.NewReport()
+
+		manifest := `{"websocket": ` + tc.websocket + `, "store_response_qjson": {"first": "messages.0"}}`
+		var test Case
+		err := json.Unmarshal([]byte(manifest), &test)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.ServerURL = ts.URL
+		test.dataStore = datastore.NewStore(false)
+		test.loader = template.NewLoader(test.dataStore)
+
+		if test.runAPITestCase(r.Root()) != tc.success {
+			t.Errorf("%s: expected success=%v", tc.websocket, tc.success)
+		}
+
+		first, err := test.dataStore.Get("first")
+		go_test_utils.ExpectNoError(t, err, "first message not stored")
+		go_test_utils.AssertStringEquals(t, "hello", first.(string))
+	}
+}
+
+func TestWebSocketTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(websocket.Server{Handler: wsEcho})
+	defer ts.Close()
+
+	filesystem.Fs = afero.NewMemMapFs()
+	afero.WriteFile(filesystem.Fs, "manifest/ca.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0644)
+
+	tests := []struct {
+		http    string
+		success bool
+	}{
+		{`{}`, true},
+		{`{"verify_tls": true}`, false},
+		{`{"verify_tls": true, "ca_cert": "ca.pem"}`, true},
+	}
+
+	for _, tc := range tests {
+		var test Case
+		err := json.Unmarshal([]byte(`{"websocket": {"endpoint": "echo", "send": ["hello"], "expect": ["hello"], "http": `+tc.http+`}}`), &test)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.ServerURL = ts.URL
+		test.manifestDir = "manifest"
+		test.dataStore = datastore.NewStore(false)
+		test.loader = template.NewLoader(test.dataStore)
+
+		if test.runAPITestCase(report.NewReport().Root()) != tc.success {
+			t.Errorf("%s: expected success=%v", tc.http, tc.success)
+		}
+	}
+}
+
+func TestWebSocketURL(t *testing.T) {
+	tests := []struct {
+		serverURL string
+		endpoint  string
+		url       string
+		origin    string
+	}{
+		{"http://localhost:8080", "echo", "ws://localhost:8080/echo", "http://localhost:8080"},
+		{"https://localhost/api/", "/ws?token=1", "wss://localhost/api/ws?token=1", "https://localhost"},
+		{"ws://localhost", "echo", "ws://localhost/echo", "http://localhost"},
+	}
+
+	for _, tc := range tests {
+		u, origin, err := webSocketURL(tc.serverURL, tc.endpoint)
+		go_test_utils.ExpectNoError(t, err, tc.serverURL)
+		go_test_utils.AssertStringEquals(t, tc.url, u)
+		go_test_utils.AssertStringEquals(t, tc.origin, origin)
+	}
+
+	_, _, err := webSocketURL("ftp://localhost", "echo")
+	go_test_utils.ExpectError(t, err, "expected error for ftp server url")
+}